@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/azure/knarly/test/e2e/specs"
@@ -21,9 +23,13 @@ import (
 	"sigs.k8s.io/cluster-api/util"
 )
 
+// interruptCtx is cancelled when the suite is interrupted, until stopNotifyingInterrupts is called after the suite.
+var interruptCtx, stopNotifyingInterrupts = signal.NotifyContext(context.TODO(), os.Interrupt, syscall.SIGTERM)
+
 var _ = Describe("Workload cluster creation", func() {
 	var (
-		ctx                   = context.TODO()
+		// ctx is cancelled when the suite is interrupted, which stops any clusterloader2 workload still running
+		ctx                   = interruptCtx
 		specName              = "create-workload-cluster"
 		namespace             *corev1.Namespace
 		cancelWatches         context.CancelFunc
@@ -31,6 +37,10 @@ var _ = Describe("Workload cluster creation", func() {
 		clusterName           string
 		clusterNamePrefix     string
 		additionalCleanup     func()
+		clusterLoader2        *specs.ClusterLoader2
+		summary               *specs.SpecSummary
+		baseline              *specs.BaselineConfig
+		events                specs.EventFilter
 		specTimes             = map[string]time.Time{}
 		podChurnRateSLOTarget = specs.PodChurnTestConfig{
 			Namespaces:          2,
@@ -40,6 +50,19 @@ var _ = Describe("Workload cluster creation", func() {
 			PodsPerNode:         10,
 			PodChurnRate:        50,
 			PodsPerDeployment:   32,
+			SLO: specs.ClusterLoader2SLO{
+				MinSchedulingThroughput: 5,
+				MaxPodStartupLatencyP99: 5 * time.Minute,
+			},
+		}
+		nakedPodChurnRateSLOTarget = specs.NakedPodChurnTestConfig{
+			Cleanup:             1,
+			PodStartTimeoutMins: 25,
+			PodsPerNode:         10,
+			PodChurnRate:        50,
+			SLO: specs.ClusterLoader2SLO{
+				MinSchedulingThroughput: 5,
+			},
 		}
 		statefulSetAzureFileChurnRateSLOTarget = specs.StatefulSetTestConfig{
 			Namespaces:            1,
@@ -49,6 +72,9 @@ var _ = Describe("Workload cluster creation", func() {
 			PvcStorageClass:       "azurefile-csi",
 			PvcStorageQuantity:    "8Gi",
 			PodManagementPolicy:   "Parallel",
+			SLO: specs.ClusterLoader2SLO{
+				MaxOverallDuration: 60 * time.Minute,
+			},
 		}
 		statefulSetAzureDiskChurnRateSLOTarget = specs.StatefulSetTestConfig{
 			Namespaces:            1,
@@ -58,10 +84,69 @@ var _ = Describe("Workload cluster creation", func() {
 			PvcStorageClass:       "azuredisk-csi",
 			PvcStorageQuantity:    "8Gi",
 			PodManagementPolicy:   "Parallel",
+			SLO: specs.ClusterLoader2SLO{
+				MaxOverallDuration: 60 * time.Minute,
+			},
+		}
+		watchFanOutSLOTarget = specs.WatchFanOutTestConfig{
+			Namespaces:             5,
+			ConfigMapsPerNamespace: 20,
+			SecretsPerNamespace:    20,
+			ObjectSizeBytes:        4096,
+			WatchersPerNamespace:   20,
+			UpdateQPS:              20,
+			UpdateDurationMins:     10,
+			SLO: specs.WatchFanOutSLO{
+				MaxWatchDelayP99:  5 * time.Second,
+				MinDeliveredRatio: 0.99,
+			},
+		}
+		namespaceLifecycleSLOTarget = specs.NamespaceLifecycleConfig{
+			TestID:                 "namespace-lifecycle",
+			Namespaces:             100,
+			NamespaceRate:          5,
+			ConfigMapsPerNamespace: 10,
+			SecretsPerNamespace:    10,
+			ServicesPerNamespace:   2,
+			PodsPerNamespace:       5,
+			TerminationTimeout:     15 * time.Minute,
+			SLO: specs.NamespaceLifecycleSLO{
+				MaxTerminationP99: 5 * time.Minute,
+			},
+		}
+		listLoadSLOTarget = specs.ListLoadConfig{
+			Resources:            []string{"pods", "events"},
+			FullListCallers:      2,
+			PaginatedListCallers: 2,
+			ListsPerSecond:       0.5,
+			PageSize:             500,
+			RequestTimeout:       time.Minute,
+			SLO: specs.ListLoadSLO{
+				MaxLatencyP99: 30 * time.Second,
+			},
+		}
+		customObjectScaleSLOTarget = specs.CustomObjectScaleConfig{
+			TestID:              "custom-object-scale",
+			Namespaces:          10,
+			ObjectsPerNamespace: 1000,
+			ObjectSizeBytes:     2048,
+			UpdatesPerObject:    1,
+			OperationRate:       100,
+			TargetCountTimeout:  5 * time.Minute,
+			SLO: specs.CustomObjectScaleSLO{
+				MaxLatencyP99: time.Second,
+			},
 		}
 	)
 
 	BeforeEach(func() {
+		// first, so AfterEach always has the summary of this spec, also when the checks below fail
+		summary = &specs.SpecSummary{
+			Spec:       CurrentGinkgoTestDescription().TestText,
+			GinkgoNode: GinkgoParallelNode(),
+			Started:    time.Now(),
+		}
+		baseline = nil
 		utils.LogCheckpoint(specTimes)
 
 		Expect(ctx).NotTo(BeNil(), "ctx is required for %s spec", specName)
@@ -71,10 +156,31 @@ var _ = Describe("Workload cluster creation", func() {
 		Expect(os.MkdirAll(artifactFolder, 0755)).To(Succeed(), "Invalid argument. artifactFolder can't be created for %s spec", specName)
 		Expect(e2eConfig.Variables).To(HaveKey(capi_e2e.KubernetesVersion))
 
+		// Validate workload parameters before any Azure resources are created.
+		for _, params := range []specs.WorkloadParams{
+			podChurnRateSLOTarget,
+			nakedPodChurnRateSLOTarget,
+			statefulSetAzureFileChurnRateSLOTarget,
+			statefulSetAzureDiskChurnRateSLOTarget,
+			watchFanOutSLOTarget,
+		} {
+			Expect(params.Validate()).To(Succeed(), "Invalid parameters for workload %q in %s spec", params.WorkloadName(), specName)
+		}
+		Expect(namespaceLifecycleSLOTarget.Validate()).To(Succeed(), "Invalid parameters for workload %q in %s spec", specs.NamespaceLifecycleWorkload, specName)
+		Expect(listLoadSLOTarget.Validate()).To(Succeed(), "Invalid parameters for workload %q in %s spec", specs.ListLoadWorkload, specName)
+		Expect(customObjectScaleSLOTarget.Validate()).To(Succeed(), "Invalid parameters for workload %q in %s spec", specs.CustomObjectScaleWorkload, specName)
+
+		// Find clusterloader2 and the workload configs before any Azure resources are created.
+		var err error
+		clusterLoader2, err = specs.ResolveClusterLoader2(e2eConfig)
+		Expect(err).NotTo(HaveOccurred(), "clusterloader2 is required to run workloads in %s spec", specName)
+		baseline, err = specs.ResolveBaselineConfig(e2eConfig)
+		Expect(err).NotTo(HaveOccurred(), "Invalid baseline config for %s spec", specName)
+		events = specs.ResolveEventFilter(e2eConfig)
+
 		clusterNamePrefix = fmt.Sprintf("knarly-e2e-%s", util.RandomString(6))
 
 		// Setup a Namespace where to host objects for this spec and create a watcher for the namespace events.
-		var err error
 		namespace, cancelWatches, err = utils.SetupSpecNamespace(ctx, clusterNamePrefix, bootstrapClusterProxy, artifactFolder)
 		Expect(err).NotTo(HaveOccurred())
 
@@ -122,16 +228,33 @@ var _ = Describe("Workload cluster creation", func() {
 			ArtifactFolder:    artifactFolder,
 			E2eConfig:         e2eConfig,
 		}
-		utils.DumpSpecResourcesAndCleanup(ctx, cleanInput)
+		summary.LogCollectionDuration = utils.DumpSpecResourcesAndCleanup(ctx, cleanInput)
+		summary.Duration = time.Since(summary.Started)
+		// regressions are recorded in the summary before it is written, so a regressed run never becomes the baseline
+		var regressions []specs.Regression
+		var compareErr error
+		if baseline != nil {
+			regressions, compareErr = specs.RecordRegressions(*baseline, summary)
+		}
+		summary.Passed = !CurrentGinkgoTestDescription().Failed && compareErr == nil && len(regressions) == 0
+		if err := specs.WriteSpecSummary(artifactFolder, GinkgoParallelNode(), summary); err != nil {
+			utils.Logf("failed to write the summary of the %q spec: %v", summary.Spec, err)
+		}
 		Expect(os.Unsetenv(utils.AzureResourceGroup)).NotTo(HaveOccurred())
 		Expect(os.Unsetenv(utils.AzureVNetName)).NotTo(HaveOccurred())
 
 		utils.LogCheckpoint(specTimes)
+
+		// last, as a regression fails the spec without stopping the cleanup
+		if baseline != nil {
+			Expect(compareErr).ToNot(HaveOccurred(), "Failed to compare the %s spec to its baseline", specName)
+			specs.ExpectNoRegressions(*baseline, regressions)
+		}
 	})
 
 	It("With the aks flavor", func() {
 		clusterName = utils.GetClusterName(clusterNamePrefix, "aks")
-		clusterctl.ApplyClusterTemplateAndWait(ctx, clusterctl.ApplyClusterTemplateAndWaitInput{
+		applyClusterTemplateAndWait(ctx, clusterctl.ApplyClusterTemplateAndWaitInput{
 			ClusterProxy: bootstrapClusterProxy,
 			ConfigCluster: clusterctl.ConfigClusterInput{
 				LogFolder:                filepath.Join(artifactFolder, "clusters", bootstrapClusterProxy.GetName()),
@@ -152,7 +275,7 @@ var _ = Describe("Workload cluster creation", func() {
 				WaitForControlPlaneInitialized:   WaitForControlPlaneInitialized,
 				WaitForControlPlaneMachinesReady: WaitForControlPlaneMachinesReady,
 			},
-		}, result)
+		}, result, summary)
 
 		Context("Listing Namespaces in workload cluster", func() {
 			specs.ListNamespaces(ctx, specs.ClusterTestInput{
@@ -161,13 +284,18 @@ var _ = Describe("Workload cluster creation", func() {
 			})
 		})
 
-		Context("Running pod churn tests against workload cluster", func() {
-			specs.RunPodChurnTest(ctx,
-				specs.ClusterTestInput{
-					BootstrapClusterProxy: bootstrapClusterProxy,
-					Cluster:               result.Cluster,
-				},
-				podChurnRateSLOTarget)
+		Context("Running pod churn tests with LIST load against workload cluster", func() {
+			input := specs.ClusterTestInput{
+				BootstrapClusterProxy: bootstrapClusterProxy,
+				Cluster:               result.Cluster,
+				ArtifactFolder:        artifactFolder,
+				ClusterLoader2:        clusterLoader2,
+				Summary:               summary,
+				Events:                events,
+			}
+			specs.RunWithListLoad(ctx, input, listLoadSLOTarget, func() {
+				specs.RunPodChurnTest(ctx, input, podChurnRateSLOTarget)
+			})
 		})
 
 		Context("Running statefulset azurefile-csi churn tests against workload cluster", func() {
@@ -175,6 +303,10 @@ var _ = Describe("Workload cluster creation", func() {
 				specs.ClusterTestInput{
 					BootstrapClusterProxy: bootstrapClusterProxy,
 					Cluster:               result.Cluster,
+					ArtifactFolder:        artifactFolder,
+					ClusterLoader2:        clusterLoader2,
+					Summary:               summary,
+					Events:                events,
 				},
 				statefulSetAzureFileChurnRateSLOTarget)
 		})
@@ -184,16 +316,111 @@ var _ = Describe("Workload cluster creation", func() {
 				specs.ClusterTestInput{
 					BootstrapClusterProxy: bootstrapClusterProxy,
 					Cluster:               result.Cluster,
+					ArtifactFolder:        artifactFolder,
+					ClusterLoader2:        clusterLoader2,
+					Summary:               summary,
+					Events:                events,
 				},
 				statefulSetAzureDiskChurnRateSLOTarget)
 		})
+
+		Context("Running watch fan-out tests against workload cluster", func() {
+			specs.RunWatchFanOutTest(ctx,
+				specs.ClusterTestInput{
+					BootstrapClusterProxy: bootstrapClusterProxy,
+					Cluster:               result.Cluster,
+					ArtifactFolder:        artifactFolder,
+					ClusterLoader2:        clusterLoader2,
+					Summary:               summary,
+					Events:                events,
+				},
+				watchFanOutSLOTarget)
+		})
+
+		Context("Running namespace lifecycle tests against workload cluster", func() {
+			specs.RunNamespaceLifecycleTest(ctx,
+				specs.ClusterTestInput{
+					BootstrapClusterProxy: bootstrapClusterProxy,
+					Cluster:               result.Cluster,
+					ArtifactFolder:        artifactFolder,
+					ClusterLoader2:        clusterLoader2,
+					Summary:               summary,
+					Events:                events,
+				},
+				namespaceLifecycleSLOTarget)
+		})
+
+		Context("Running custom object scale tests against workload cluster", func() {
+			specs.RunCustomObjectScaleTest(ctx,
+				specs.ClusterTestInput{
+					BootstrapClusterProxy: bootstrapClusterProxy,
+					Cluster:               result.Cluster,
+					ArtifactFolder:        artifactFolder,
+					ClusterLoader2:        clusterLoader2,
+					Summary:               summary,
+					Events:                events,
+				},
+				customObjectScaleSLOTarget)
+		})
+	})
+
+	It("With the aks flavor comparing naked pod and deployment churn", func() {
+		clusterName = utils.GetClusterName(clusterNamePrefix, "aks-churn")
+		applyClusterTemplateAndWait(ctx, clusterctl.ApplyClusterTemplateAndWaitInput{
+			ClusterProxy: bootstrapClusterProxy,
+			ConfigCluster: clusterctl.ConfigClusterInput{
+				LogFolder:                filepath.Join(artifactFolder, "clusters", bootstrapClusterProxy.GetName()),
+				ClusterctlConfigPath:     clusterctlConfigPath,
+				KubeconfigPath:           bootstrapClusterProxy.GetKubeconfigPath(),
+				InfrastructureProvider:   clusterctl.DefaultInfrastructureProvider,
+				Flavor:                   "aks",
+				Namespace:                namespace.Name,
+				ClusterName:              clusterName,
+				KubernetesVersion:        e2eConfig.GetVariable(utils.AKSKubernetesVersion),
+				ControlPlaneMachineCount: pointer.Int64Ptr(1),
+				WorkerMachineCount:       pointer.Int64Ptr(10),
+			},
+			WaitForClusterIntervals:      e2eConfig.GetIntervals(specName, "wait-cluster"),
+			WaitForControlPlaneIntervals: e2eConfig.GetIntervals(specName, "wait-control-plane"),
+			WaitForMachineDeployments:    e2eConfig.GetIntervals(specName, "wait-worker-nodes"),
+			ControlPlaneWaiters: clusterctl.ControlPlaneWaiters{
+				WaitForControlPlaneInitialized:   WaitForControlPlaneInitialized,
+				WaitForControlPlaneMachinesReady: WaitForControlPlaneMachinesReady,
+			},
+		}, result, summary)
+
+		Context("Running naked pod churn tests against workload cluster", func() {
+			specs.RunNakedPodChurnTest(ctx,
+				specs.ClusterTestInput{
+					BootstrapClusterProxy: bootstrapClusterProxy,
+					Cluster:               result.Cluster,
+					ArtifactFolder:        artifactFolder,
+					ClusterLoader2:        clusterLoader2,
+					Summary:               summary,
+					Events:                events,
+				},
+				nakedPodChurnRateSLOTarget)
+		})
+
+		Context("Running pod churn tests against workload cluster", func() {
+			specs.RunPodChurnTest(ctx,
+				specs.ClusterTestInput{
+					BootstrapClusterProxy: bootstrapClusterProxy,
+					Cluster:               result.Cluster,
+					ArtifactFolder:        artifactFolder,
+					ClusterLoader2:        clusterLoader2,
+					Summary:               summary,
+					Events:                events,
+				},
+				podChurnRateSLOTarget)
+		})
 	})
 
 	It("Run multi cluster test", func() {
 		result1 := new(clusterctl.ApplyClusterTemplateAndWaitResult)
 		result2 := new(clusterctl.ApplyClusterTemplateAndWaitResult)
 		clusterName = utils.GetClusterName(clusterNamePrefix, "aks1")
-		clusterctl.ApplyClusterTemplateAndWait(ctx, clusterctl.ApplyClusterTemplateAndWaitInput{
+		applyClusterTemplateAndWait(ctx, clusterctl.ApplyClusterTemplateAndWaitInput{
 			ClusterProxy: bootstrapClusterProxy,
 			ConfigCluster: clusterctl.ConfigClusterInput{
 				LogFolder:                filepath.Join(artifactFolder, "clusters", bootstrapClusterProxy.GetName()),
@@ -214,10 +441,10 @@ var _ = Describe("Workload cluster creation", func() {
 				WaitForControlPlaneInitialized:   WaitForControlPlaneInitialized,
 				WaitForControlPlaneMachinesReady: WaitForControlPlaneMachinesReady,
 			},
-		}, result1)
+		}, result1, summary)
 
 		clusterName = utils.GetClusterName(clusterNamePrefix, "aks2")
-		clusterctl.ApplyClusterTemplateAndWait(ctx, clusterctl.ApplyClusterTemplateAndWaitInput{
+		applyClusterTemplateAndWait(ctx, clusterctl.ApplyClusterTemplateAndWaitInput{
 			ClusterProxy: bootstrapClusterProxy,
 			ConfigCluster: clusterctl.ConfigClusterInput{
 				LogFolder:                filepath.Join(artifactFolder, "clusters", bootstrapClusterProxy.GetName()),
@@ -238,7 +465,7 @@ var _ = Describe("Workload cluster creation", func() {
 				WaitForControlPlaneInitialized:   WaitForControlPlaneInitialized,
 				WaitForControlPlaneMachinesReady: WaitForControlPlaneMachinesReady,
 			},
-		}, result2)
+		}, result2, summary)
 
 		Context("Listing Namespaces in workload cluster", func() {
 			specs.ListNamespaces(ctx, specs.ClusterTestInput{
@@ -256,3 +483,37 @@ var _ = Describe("Workload cluster creation", func() {
 	})
 
 })
+
+// applyClusterTemplateAndWait applies the cluster template and waits for the cluster to be ready like
+// clusterctl.ApplyClusterTemplateAndWait, and adds the cluster to the summary of the spec, also when it fails to come up.
+// The provisioning timeline of the cluster is written among its artifacts.
+func applyClusterTemplateAndWait(ctx context.Context, input clusterctl.ApplyClusterTemplateAndWaitInput, result *clusterctl.ApplyClusterTemplateAndWaitResult, summary *specs.SpecSummary) {
+	cluster := &specs.ClusterSummary{
+		Name:              input.ConfigCluster.ClusterName,
+		Flavor:            input.ConfigCluster.Flavor,
+		KubernetesVersion: input.ConfigCluster.KubernetesVersion,
+	}
+	// the configured version may only be a major.minor, which AKS resolves to its latest patch
+	if version, err := GetAKSKubernetesVersion(ctx, e2eConfig); err == nil {
+		cluster.KubernetesVersion = version
+	} else {
+		utils.Logf("failed to get the AKS kubernetes version of cluster %s, summarizing the configured %s: %v", cluster.Name, cluster.KubernetesVersion, err)
+	}
+	summary.Clusters = append(summary.Clusters, cluster)
+
+	watcher := specs.NewProvisioningWatcher(input.ClusterProxy.GetClient(), input.ConfigCluster.Namespace, cluster.Name)
+	watcher.Start(ctx)
+	start := time.Now()
+	defer func() {
+		cluster.ProvisioningDuration = time.Since(start)
+		if err := specs.WriteProvisioningTimeline(artifactFolder, watcher.Stop(ctx)); err != nil {
+			utils.Logf("failed to write the provisioning timeline of cluster %s: %v", cluster.Name, err)
+		}
+	}()
+	clusterctl.ApplyClusterTemplateAndWait(ctx, input, result)
+
+	clusterProxy := input.ClusterProxy.GetWorkloadCluster(ctx, result.Cluster.Namespace, result.Cluster.Name)
+	if err := specs.SummarizeClusterNodes(ctx, clusterProxy.GetClientSet(), cluster); err != nil {
+		utils.Logf("failed to summarize the nodes of cluster %s: %v", cluster.Name, err)
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	aadpodv1 "github.com/Azure/aad-pod-identity/pkg/apis/aadpodidentity/v1"
+	"github.com/azure/knarly/test/e2e/specs"
 	"github.com/azure/knarly/test/e2e/utils"
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/ginkgo/config"
@@ -26,6 +28,9 @@ import (
 	"sigs.k8s.io/cluster-api/test/framework/clusterctl"
 )
 
+// pushMetricsTimeout bounds pushing the run metrics, so an unresponsive pushgateway can't hang the end of the suite.
+const pushMetricsTimeout = time.Minute
+
 func TestE2E(t *testing.T) {
 	RegisterFailHandler(Fail)
 	junitPath := filepath.Join(artifactFolder, fmt.Sprintf("junit.e2e_suite.%d.xml", config.GinkgoConfig.ParallelNode))
@@ -85,15 +90,56 @@ var _ = SynchronizedBeforeSuite(func() []byte {
 // The local clusterctl repository is preserved like everything else created into the artifact folder.
 var _ = SynchronizedAfterSuite(func() {
 	// After each ParallelNode.
+
+	stopNotifyingInterrupts()
 }, func() {
 	// After all ParallelNodes.
 
+	By("Writing the run summary")
+	run, err := specs.WriteRunSummary(artifactFolder)
+	if err != nil {
+		utils.Logf("failed to write the run summary: %v", err)
+	} else {
+		exportRunMetrics(run)
+	}
+	baseline, err := specs.ResolveBaselineConfig(e2eConfig)
+	if err != nil {
+		utils.Logf("not storing the results of the run: %v", err)
+	} else if baseline != nil {
+		By("Storing the results of the run as a baseline for later runs")
+		if _, err := specs.StoreRunResults(baseline.ResultsDir, artifactFolder); err != nil {
+			utils.Logf("failed to store the results of the run in %s: %v", baseline.ResultsDir, err)
+		}
+	}
+
 	By("Tearing down the management cluster")
 	if !skipCleanup {
 		tearDown(bootstrapClusterProvider, bootstrapClusterProxy)
 	}
 })
 
+// exportRunMetrics writes the run summary as OpenMetrics to the artifact folder, and pushes it to the pushgateway
+// configured by KNARLY_PUSHGATEWAY_URL, if any.
+func exportRunMetrics(run *specs.RunSummary) {
+	if err := specs.WriteOpenMetrics(artifactFolder, run); err != nil {
+		utils.Logf("failed to write the run metrics: %v", err)
+	}
+	push, err := specs.ResolvePushConfig(e2eConfig)
+	if err != nil {
+		utils.Logf("not pushing the run metrics: %v", err)
+		return
+	}
+	if push == nil {
+		return
+	}
+	By("Pushing the run metrics to " + push.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), pushMetricsTimeout)
+	defer cancel()
+	if err := specs.PushOpenMetrics(ctx, *push, run); err != nil {
+		utils.Logf("failed to push the run metrics: %v", err)
+	}
+}
+
 func setupBootstrapCluster(config *clusterctl.E2EConfig, scheme *runtime.Scheme, useExistingCluster bool) (bootstrap.ClusterProvider, framework.ClusterProxy) {
 	var clusterProvider bootstrap.ClusterProvider
 	kubeconfigPath := ""
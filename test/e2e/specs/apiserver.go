@@ -0,0 +1,224 @@
+package specs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// apiServerRequestDurationMetric is the API server histogram of request latencies, labelled by verb, group and
+	// resource.
+	apiServerRequestDurationMetric = "apiserver_request_duration_seconds"
+	// apiServerStorageObjectsMetric is the API server gauge of the number of objects in etcd, labelled by resource.
+	apiServerStorageObjectsMetric = "apiserver_storage_objects"
+)
+
+type (
+	// APIServerRequestKey identifies the requests a latency histogram is aggregated over.
+	APIServerRequestKey struct {
+		Verb string
+		// Group is the API group of the resource, empty for the core group
+		Group    string
+		Resource string
+	}
+
+	// APIServerLatencySnapshot holds the cumulative request duration histograms of an API server at one point in time.
+	APIServerLatencySnapshot map[APIServerRequestKey]*apiServerHistogram
+
+	// APIServerLatency are the request latency percentiles of one verb, group and resource over a workload.
+	APIServerLatency struct {
+		Verb string `json:"verb"`
+		// Group is the API group of the resource, empty for the core group
+		Group    string        `json:"group"`
+		Resource string        `json:"resource"`
+		Count    uint64        `json:"count"`
+		Perc50   time.Duration `json:"perc50"`
+		Perc90   time.Duration `json:"perc90"`
+		Perc99   time.Duration `json:"perc99"`
+	}
+
+	apiServerHistogram struct {
+		count uint64
+		// buckets maps the upper bound of each finite bucket, in seconds, to its cumulative count
+		buckets map[float64]uint64
+	}
+)
+
+// ScrapeAPIServerLatency reads the request duration histograms from the /metrics endpoint of the API server clientSet
+// talks to.
+func ScrapeAPIServerLatency(ctx context.Context, clientSet kubernetes.Interface) (APIServerLatencySnapshot, error) {
+	b, err := clientSet.CoreV1().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "scraping API server metrics")
+	}
+	return parseAPIServerLatency(bytes.NewReader(b))
+}
+
+func parseAPIServerLatency(r io.Reader) (APIServerLatencySnapshot, error) {
+	families, err := (&expfmt.TextParser{}).TextToMetricFamilies(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing API server metrics")
+	}
+	snapshot := APIServerLatencySnapshot{}
+	family, ok := families[apiServerRequestDurationMetric]
+	if !ok {
+		return snapshot, nil
+	}
+	for _, m := range family.GetMetric() {
+		if m.GetHistogram() == nil {
+			continue
+		}
+		key := APIServerRequestKey{Verb: labelValue(m, "verb"), Group: labelValue(m, "group"), Resource: labelValue(m, "resource")}
+		h, ok := snapshot[key]
+		if !ok {
+			h = &apiServerHistogram{buckets: map[float64]uint64{}}
+			snapshot[key] = h
+		}
+		// series differing only in labels other than verb, group and resource, e.g. scope or subresource, are summed up
+		h.count += m.GetHistogram().GetSampleCount()
+		for _, b := range m.GetHistogram().GetBucket() {
+			if !math.IsInf(b.GetUpperBound(), 1) {
+				h.buckets[b.GetUpperBound()] += b.GetCumulativeCount()
+			}
+		}
+	}
+	return snapshot, nil
+}
+
+// DiffAPIServerLatency returns the latency percentiles of the requests served between the before and after snapshots,
+// busiest first. Verbs, groups and resources without requests in between are left out.
+func DiffAPIServerLatency(before, after APIServerLatencySnapshot) []APIServerLatency {
+	var latencies []APIServerLatency
+	for key, a := range after {
+		delta := &apiServerHistogram{count: a.count, buckets: map[float64]uint64{}}
+		for bound, count := range a.buckets {
+			delta.buckets[bound] = count
+		}
+		// a count going backwards means the API server restarted, so everything after counts
+		if b, ok := before[key]; ok && b.count <= a.count {
+			delta.count -= b.count
+			for bound, count := range b.buckets {
+				if delta.buckets[bound] >= count {
+					delta.buckets[bound] -= count
+				}
+			}
+		}
+		if delta.count == 0 {
+			continue
+		}
+		latencies = append(latencies, APIServerLatency{
+			Verb:     key.Verb,
+			Group:    key.Group,
+			Resource: key.Resource,
+			Count:    delta.count,
+			Perc50:   delta.quantile(0.5),
+			Perc90:   delta.quantile(0.9),
+			Perc99:   delta.quantile(0.99),
+		})
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		if latencies[i].Count != latencies[j].Count {
+			return latencies[i].Count > latencies[j].Count
+		}
+		if latencies[i].Group != latencies[j].Group {
+			return latencies[i].Group < latencies[j].Group
+		}
+		if latencies[i].Resource != latencies[j].Resource {
+			return latencies[i].Resource < latencies[j].Resource
+		}
+		return latencies[i].Verb < latencies[j].Verb
+	})
+	return latencies
+}
+
+// quantile estimates the q quantile the way Prometheus' histogram_quantile does, by interpolating linearly within the
+// bucket the quantile falls in. Quantiles falling in the +Inf bucket are capped at the highest finite bound.
+func (h *apiServerHistogram) quantile(q float64) time.Duration {
+	bounds := make([]float64, 0, len(h.buckets))
+	for bound := range h.buckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+	rank := q * float64(h.count)
+	lowerBound, lowerCount := 0.0, 0.0
+	for _, bound := range bounds {
+		count := float64(h.buckets[bound])
+		if count >= rank {
+			seconds := bound
+			if count > lowerCount {
+				seconds = lowerBound + (bound-lowerBound)*(rank-lowerCount)/(count-lowerCount)
+			}
+			return time.Duration(seconds * float64(time.Second))
+		}
+		lowerBound, lowerCount = bound, count
+	}
+	return time.Duration(lowerBound * float64(time.Second))
+}
+
+// writeAPIServerLatencyTable writes latencies to path as a plain text table, showing the core group as "core".
+func writeAPIServerLatencyTable(path string, latencies []APIServerLatency) error {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERB\tGROUP\tRESOURCE\tCOUNT\tP50\tP90\tP99")
+	for _, l := range latencies {
+		group := l.Group
+		if group == "" {
+			group = "core"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", l.Verb, group, l.Resource, l.Count, l.Perc50.Round(time.Millisecond), l.Perc90.Round(time.Millisecond), l.Perc99.Round(time.Millisecond))
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrapf(err, "rendering %s", path)
+	}
+	if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	return nil
+}
+
+// ScrapeAPIServerStorageObjects reads the number of objects in etcd by resource, e.g. "pods" or
+// "deployments.apps", from the /metrics endpoint of the API server clientSet talks to. The API server updates the
+// counts periodically, so they lag behind creations and deletions.
+func ScrapeAPIServerStorageObjects(ctx context.Context, clientSet kubernetes.Interface) (map[string]int64, error) {
+	b, err := clientSet.CoreV1().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "scraping API server metrics")
+	}
+	return parseAPIServerStorageObjects(bytes.NewReader(b))
+}
+
+func parseAPIServerStorageObjects(r io.Reader) (map[string]int64, error) {
+	families, err := (&expfmt.TextParser{}).TextToMetricFamilies(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing API server metrics")
+	}
+	counts := map[string]int64{}
+	for _, m := range families[apiServerStorageObjectsMetric].GetMetric() {
+		// a count of -1 means the API server failed to get the count from etcd
+		if m.GetGauge() != nil && m.GetGauge().GetValue() >= 0 {
+			counts[labelValue(m, "resource")] = int64(m.GetGauge().GetValue())
+		}
+	}
+	return counts, nil
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
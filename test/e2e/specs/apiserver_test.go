@@ -0,0 +1,119 @@
+package specs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+const apiServerMetricsBefore = `# HELP apiserver_request_duration_seconds [STABLE] Response latency distribution in seconds for each verb, dry run value, group, version, resource, subresource, scope and component.
+# TYPE apiserver_request_duration_seconds histogram
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="namespace",verb="POST",le="0.1"} 10
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="namespace",verb="POST",le="0.2"} 10
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="namespace",verb="POST",le="+Inf"} 10
+apiserver_request_duration_seconds_sum{component="apiserver",resource="pods",scope="namespace",verb="POST"} 0.5
+apiserver_request_duration_seconds_count{component="apiserver",resource="pods",scope="namespace",verb="POST"} 10
+# HELP apiserver_request_total [STABLE] Counter of apiserver requests.
+# TYPE apiserver_request_total counter
+apiserver_request_total{code="201",resource="pods",verb="POST"} 10
+`
+
+const apiServerMetricsAfter = `# TYPE apiserver_request_duration_seconds histogram
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="namespace",verb="POST",le="0.1"} 60
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="namespace",verb="POST",le="0.2"} 110
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="namespace",verb="POST",le="+Inf"} 110
+apiserver_request_duration_seconds_sum{component="apiserver",resource="pods",scope="namespace",verb="POST"} 15.5
+apiserver_request_duration_seconds_count{component="apiserver",resource="pods",scope="namespace",verb="POST"} 110
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="cluster",verb="LIST",le="0.1"} 0
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="cluster",verb="LIST",le="0.2"} 1
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="cluster",verb="LIST",le="+Inf"} 2
+apiserver_request_duration_seconds_sum{component="apiserver",resource="pods",scope="cluster",verb="LIST"} 5
+apiserver_request_duration_seconds_count{component="apiserver",resource="pods",scope="cluster",verb="LIST"} 2
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="namespace",verb="LIST",le="0.1"} 1
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="namespace",verb="LIST",le="0.2"} 2
+apiserver_request_duration_seconds_bucket{component="apiserver",resource="pods",scope="namespace",verb="LIST",le="+Inf"} 2
+apiserver_request_duration_seconds_sum{component="apiserver",resource="pods",scope="namespace",verb="LIST"} 0.2
+apiserver_request_duration_seconds_count{component="apiserver",resource="pods",scope="namespace",verb="LIST"} 2
+apiserver_request_duration_seconds_bucket{component="apiserver",group="metrics.k8s.io",resource="pods",scope="namespace",verb="LIST",le="0.1"} 1
+apiserver_request_duration_seconds_bucket{component="apiserver",group="metrics.k8s.io",resource="pods",scope="namespace",verb="LIST",le="0.2"} 1
+apiserver_request_duration_seconds_bucket{component="apiserver",group="metrics.k8s.io",resource="pods",scope="namespace",verb="LIST",le="+Inf"} 1
+apiserver_request_duration_seconds_sum{component="apiserver",group="metrics.k8s.io",resource="pods",scope="namespace",verb="LIST"} 0.05
+apiserver_request_duration_seconds_count{component="apiserver",group="metrics.k8s.io",resource="pods",scope="namespace",verb="LIST"} 1
+`
+
+func TestDiffAPIServerLatency(t *testing.T) {
+	g := NewWithT(t)
+	before, err := parseAPIServerLatency(strings.NewReader(apiServerMetricsBefore))
+	g.Expect(err).NotTo(HaveOccurred())
+	after, err := parseAPIServerLatency(strings.NewReader(apiServerMetricsAfter))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	latencies := DiffAPIServerLatency(before, after)
+	g.Expect(latencies).To(HaveLen(3))
+
+	// 100 POSTs in between, half of them within 0.1s and the rest within 0.2s
+	g.Expect(latencies[0]).To(Equal(APIServerLatency{
+		Verb:     "POST",
+		Resource: "pods",
+		Count:    100,
+		Perc50:   100 * time.Millisecond,
+		Perc90:   180 * time.Millisecond,
+		Perc99:   198 * time.Millisecond,
+	}))
+
+	// LISTs are summed across scopes, and the slowest one is beyond the highest finite bucket
+	g.Expect(latencies[1].Verb).To(Equal("LIST"))
+	g.Expect(latencies[1].Count).To(BeEquivalentTo(4))
+	g.Expect(latencies[1].Perc50).To(Equal(150 * time.Millisecond))
+	g.Expect(latencies[1].Perc99).To(Equal(200 * time.Millisecond))
+
+	// pods of another group are not the core pods
+	g.Expect(latencies[2].Verb).To(Equal("LIST"))
+	g.Expect(latencies[2].Group).To(Equal("metrics.k8s.io"))
+	g.Expect(latencies[2].Count).To(BeEquivalentTo(1))
+}
+
+func TestWriteAPIServerLatencyTable(t *testing.T) {
+	g := NewWithT(t)
+	path := filepath.Join(t.TempDir(), "apiserver-latency.txt")
+	g.Expect(writeAPIServerLatencyTable(path, []APIServerLatency{
+		{Verb: "POST", Resource: "pods", Count: 100, Perc50: 100 * time.Millisecond, Perc90: 180 * time.Millisecond, Perc99: 198 * time.Millisecond},
+		{Verb: "LIST", Group: "metrics.k8s.io", Resource: "pods", Count: 1, Perc50: 50 * time.Millisecond, Perc90: 90 * time.Millisecond, Perc99: 99 * time.Millisecond},
+	})).To(Succeed())
+	b, err := ioutil.ReadFile(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(b)).To(Equal(`VERB  GROUP           RESOURCE  COUNT  P50    P90    P99
+POST  core            pods      100    100ms  180ms  198ms
+LIST  metrics.k8s.io  pods      1      50ms   90ms   99ms
+`))
+
+	g.Expect(writeAPIServerLatencyTable(filepath.Join(t.TempDir(), "missing", "apiserver-latency.txt"), nil)).NotTo(Succeed())
+}
+
+func TestDiffAPIServerLatencyAfterRestart(t *testing.T) {
+	g := NewWithT(t)
+	before, err := parseAPIServerLatency(strings.NewReader(apiServerMetricsAfter))
+	g.Expect(err).NotTo(HaveOccurred())
+	after, err := parseAPIServerLatency(strings.NewReader(apiServerMetricsBefore))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	latencies := DiffAPIServerLatency(before, after)
+	g.Expect(latencies).To(HaveLen(1))
+	g.Expect(latencies[0].Count).To(BeEquivalentTo(10))
+}
+
+func TestParseAPIServerStorageObjects(t *testing.T) {
+	g := NewWithT(t)
+	counts, err := parseAPIServerStorageObjects(strings.NewReader(apiServerMetricsBefore + `# HELP apiserver_storage_objects [STABLE] Number of stored objects at the time of last check split by kind.
+# TYPE apiserver_storage_objects gauge
+apiserver_storage_objects{resource="pods"} 120
+apiserver_storage_objects{resource="scaleobjects.knarly.azure.com"} 5000
+apiserver_storage_objects{resource="leases.coordination.k8s.io"} -1
+`))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(counts).To(Equal(map[string]int64{"pods": 120, "scaleobjects.knarly.azure.com": 5000}))
+}
@@ -0,0 +1,386 @@
+package specs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/cluster-api/test/framework/clusterctl"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// LatestBaseline compares against the most recent stored run with the same baseline key.
+	LatestBaseline = "latest"
+
+	// HigherIsBetter marks metrics that regress when they drop, e.g. throughput.
+	HigherIsBetter = "higher"
+	// LowerIsBetter marks metrics that regress when they grow, e.g. latency.
+	LowerIsBetter = "lower"
+
+	// RegressionFail fails the spec on a regression.
+	RegressionFail = "fail"
+	// RegressionWarn only logs a regression.
+	RegressionWarn = "warn"
+)
+
+// DefaultRegressionRules fail on a drop in scheduling throughput or a rise in pod startup latency, and warn on a rise
+// in any other duration.
+var DefaultRegressionRules = []RegressionRule{
+	{Metric: "scheduling_throughput_pods_per_second", Better: HigherIsBetter, Tolerance: 0.2, Action: RegressionFail},
+	{Metric: "pod_startup_latency_p99_seconds", Better: LowerIsBetter, Tolerance: 0.3, Action: RegressionFail},
+	{Metric: "*_seconds", Better: LowerIsBetter, Tolerance: 0.3, Action: RegressionWarn},
+}
+
+type (
+	// BaselineConfig configures where workload results are stored and how a run is compared to them.
+	BaselineConfig struct {
+		// ResultsDir is where the results of each run are stored, by baseline key
+		ResultsDir string
+		// Baseline is the run to compare against, either LatestBaseline or the ID of a stored run
+		Baseline string
+		// Rules are the tolerances of the compared metrics, where the first rule matching a metric applies
+		Rules []RegressionRule
+	}
+
+	// RegressionRule is the tolerance of the metrics it matches.
+	RegressionRule struct {
+		// Metric is the name of the metric in the run summary, or a pattern like "*_seconds"
+		Metric string `json:"metric"`
+		// Better is HigherIsBetter or LowerIsBetter
+		Better string `json:"better"`
+		// Tolerance is the fraction of the baseline the metric may get worse by, e.g. 0.2 for 20%
+		Tolerance float64 `json:"tolerance"`
+		// Action is RegressionFail or RegressionWarn
+		Action string `json:"action"`
+	}
+
+	// BaselineKey identifies the results that are comparable: those of clusters of the same flavor, SKU, size and
+	// Kubernetes version.
+	BaselineKey struct {
+		Flavor            string `json:"flavor"`
+		SKU               string `json:"sku"`
+		Nodes             int    `json:"nodes"`
+		KubernetesVersion string `json:"kubernetesVersion"`
+	}
+
+	// BaselineRecord are the workload results of one run for one baseline key.
+	BaselineRecord struct {
+		Run       string             `json:"run"`
+		Key       BaselineKey        `json:"key"`
+		Workloads []BaselineWorkload `json:"workloads"`
+	}
+
+	// BaselineWorkload are the measurements of a workload run by a spec.
+	BaselineWorkload struct {
+		Spec string `json:"spec"`
+		// ID tells the runs of the same workload by the spec apart, see WorkloadSummary
+		ID           string             `json:"id"`
+		Workload     string             `json:"workload"`
+		Passed       bool               `json:"passed"`
+		Measurements map[string]float64 `json:"measurements"`
+		// Regressed is whether the run regressed from its own baseline, in which case it is never the latest baseline
+		Regressed bool `json:"regressed,omitempty"`
+	}
+
+	// Regression is a metric that got worse than its rule tolerates.
+	Regression struct {
+		Key      BaselineKey
+		Baseline string
+		Spec     string
+		Cluster  string
+		// Workload is the ID of the workload run, e.g. "incremental-scale-2"
+		Workload string
+		Metric   string
+		// Previous is the value of the baseline run, Current the value of this run
+		Previous float64
+		Current  float64
+		Rule     RegressionRule
+	}
+)
+
+// ResolveBaselineConfig reads the baseline config from the KNARLY_RESULTS_DIR, KNARLY_BASELINE and
+// KNARLY_REGRESSION_RULES variables. It returns nil if KNARLY_RESULTS_DIR is not set, which disables the comparison.
+func ResolveBaselineConfig(e2eConfig *clusterctl.E2EConfig) (*BaselineConfig, error) {
+	resultsDir := optionalVariable(e2eConfig, utils.ResultsDir)
+	if resultsDir == "" {
+		return nil, nil
+	}
+	config := &BaselineConfig{
+		ResultsDir: resultsDir,
+		Baseline:   optionalVariable(e2eConfig, utils.Baseline),
+		Rules:      DefaultRegressionRules,
+	}
+	if config.Baseline == "" {
+		config.Baseline = LatestBaseline
+	}
+	if rulesPath := optionalVariable(e2eConfig, utils.RegressionRules); rulesPath != "" {
+		b, err := ioutil.ReadFile(rulesPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading regression rules %s", rulesPath)
+		}
+		config.Rules = nil
+		if err := yaml.Unmarshal(b, &config.Rules); err != nil {
+			return nil, errors.Wrapf(err, "parsing regression rules %s", rulesPath)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks the config for values the comparison can't run with.
+func (c BaselineConfig) Validate() error {
+	var errs field.ErrorList
+	if c.ResultsDir == "" {
+		errs = append(errs, field.Required(field.NewPath("ResultsDir"), "is where results are stored"))
+	}
+	if c.Baseline == "" {
+		errs = append(errs, field.Required(field.NewPath("Baseline"), "is the run to compare against"))
+	}
+	for i, rule := range c.Rules {
+		rulePath := field.NewPath("Rules").Index(i)
+		if _, err := path.Match(rule.Metric, ""); rule.Metric == "" || err != nil {
+			errs = append(errs, field.Invalid(rulePath.Child("Metric"), rule.Metric, "must be a metric name or pattern"))
+		}
+		errs = append(errs, validateOneOf(rulePath.Child("Better"), rule.Better, []string{HigherIsBetter, LowerIsBetter})...)
+		if rule.Tolerance < 0 {
+			errs = append(errs, field.Invalid(rulePath.Child("Tolerance"), rule.Tolerance, "must not be negative"))
+		}
+		errs = append(errs, validateOneOf(rulePath.Child("Action"), rule.Action, []string{RegressionFail, RegressionWarn})...)
+	}
+	return errs.ToAggregate()
+}
+
+// optionalVariable returns the value of an e2e config variable, or "" if it is not set.
+func optionalVariable(e2eConfig *clusterctl.E2EConfig, name string) string {
+	if e2eConfig != nil && e2eConfig.HasVariable(name) {
+		return e2eConfig.GetVariable(name)
+	}
+	return os.Getenv(name)
+}
+
+// String renders the key as the path its results are stored under.
+func (k BaselineKey) String() string {
+	return path.Join(k.Flavor, k.SKU, fmt.Sprintf("%d-nodes", k.Nodes), k.KubernetesVersion)
+}
+
+// baselineKey returns the key of the results of the workloads run against cluster.
+func baselineKey(cluster *ClusterSummary) BaselineKey {
+	return BaselineKey{Flavor: cluster.Flavor, SKU: cluster.SKU, Nodes: cluster.Nodes, KubernetesVersion: cluster.KubernetesVersion}
+}
+
+// StoreRunResults stores the workload results of the run summary the suite wrote to the artifact folder in the results
+// directory, one record per baseline key, named after the start of the run.
+func StoreRunResults(resultsDir, artifactFolder string) ([]*BaselineRecord, error) {
+	run, err := readRunSummary(filepath.Join(artifactFolder, "summary.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(run.Specs) == 0 {
+		return nil, nil
+	}
+	// WriteRunSummary orders the specs by when they started
+	runID := run.Specs[0].Started.UTC().Format("20060102-150405")
+
+	records := map[BaselineKey]*BaselineRecord{}
+	for _, spec := range run.Specs {
+		for _, w := range spec.Workloads {
+			cluster := spec.cluster(w.Cluster)
+			if cluster == nil || len(w.Measurements) == 0 {
+				continue
+			}
+			key := baselineKey(cluster)
+			if records[key] == nil {
+				records[key] = &BaselineRecord{Run: runID, Key: key}
+			}
+			records[key].Workloads = append(records[key].Workloads, BaselineWorkload{
+				Spec:         spec.Spec,
+				ID:           w.ID,
+				Workload:     w.Name,
+				Passed:       w.Passed,
+				Measurements: w.Measurements,
+				Regressed:    w.Regressed,
+			})
+		}
+	}
+
+	stored := make([]*BaselineRecord, 0, len(records))
+	for key, record := range records {
+		dir := filepath.Join(resultsDir, filepath.FromSlash(key.String()))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, errors.Wrapf(err, "creating results directory %s", dir)
+		}
+		if err := writeJSON(filepath.Join(dir, runID+".json"), record); err != nil {
+			return nil, err
+		}
+		stored = append(stored, record)
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Key.String() < stored[j].Key.String() })
+	return stored, nil
+}
+
+// findBaseline returns the baseline run of the workload run id of spec for key, and its measurements in that run. The
+// baseline is the run named by baseline if the workload passed in it, or, for LatestBaseline, the latest run in which
+// the workload passed and didn't regress, so a regression never becomes the baseline of the next run. It returns nil if
+// there is no such run.
+func findBaseline(resultsDir, baseline string, key BaselineKey, spec, id string) (*BaselineRecord, *BaselineWorkload, error) {
+	dir := filepath.Join(resultsDir, filepath.FromSlash(key.String()))
+	paths := []string{filepath.Join(dir, baseline+".json")}
+	if baseline == LatestBaseline {
+		var err error
+		if paths, err = filepath.Glob(filepath.Join(dir, "*.json")); err != nil {
+			return nil, nil, errors.Wrapf(err, "finding results in %s", dir)
+		}
+		// run IDs are timestamps, so the latest run comes first
+		sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	}
+	for _, path := range paths {
+		record, err := readBaselineRecord(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if record == nil {
+			continue
+		}
+		for i := range record.Workloads {
+			w := &record.Workloads[i]
+			if w.Spec == spec && w.ID == id && w.Passed && (baseline != LatestBaseline || !w.Regressed) {
+				return record, w, nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// readBaselineRecord reads the stored results of a run, or returns nil if there are none.
+func readBaselineRecord(path string) (*BaselineRecord, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading baseline %s", path)
+	}
+	record := &BaselineRecord{}
+	if err := json.Unmarshal(b, record); err != nil {
+		return nil, errors.Wrapf(err, "parsing baseline %s", path)
+	}
+	return record, nil
+}
+
+// CompareToBaseline compares the measurements of the workload runs of a spec to those of the same spec and run ID in
+// the baseline run with the same key, see findBaseline, and returns the metrics that got worse than their rule
+// tolerates. Workloads without a baseline are not compared.
+func CompareToBaseline(config BaselineConfig, summary *SpecSummary) ([]Regression, error) {
+	var regressions []Regression
+	for _, w := range summary.Workloads {
+		cluster := summary.cluster(w.Cluster)
+		if cluster == nil || len(w.Measurements) == 0 {
+			continue
+		}
+		key := baselineKey(cluster)
+		record, previous, err := findBaseline(config.ResultsDir, config.Baseline, key, summary.Spec, w.ID)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			utils.Logf("no %s baseline in which workload %q passed on %s", config.Baseline, w.ID, key)
+			continue
+		}
+
+		metrics := make([]string, 0, len(w.Measurements))
+		for metric := range w.Measurements {
+			metrics = append(metrics, metric)
+		}
+		sort.Strings(metrics)
+		for _, metric := range metrics {
+			rule, ok := matchRegressionRule(config.Rules, metric)
+			prev, hasPrev := previous.Measurements[metric]
+			if !ok || !hasPrev {
+				continue
+			}
+			if regressed(rule, prev, w.Measurements[metric]) {
+				regressions = append(regressions, Regression{
+					Key:      key,
+					Baseline: record.Run,
+					Spec:     summary.Spec,
+					Cluster:  w.Cluster,
+					Workload: w.ID,
+					Metric:   metric,
+					Previous: prev,
+					Current:  w.Measurements[metric],
+					Rule:     rule,
+				})
+			}
+		}
+	}
+	return regressions, nil
+}
+
+// RecordRegressions compares the workloads of a spec to the baseline, logs every regression and records it on the
+// summary of its workload, so the results stored from the summary tell regressed runs apart. It returns the
+// regressions that breach a rule with RegressionFail, for ExpectNoRegressions once the summary is written.
+func RecordRegressions(config BaselineConfig, summary *SpecSummary) ([]Regression, error) {
+	regressions, err := CompareToBaseline(config, summary)
+	if err != nil {
+		return nil, errors.Wrapf(err, "comparing spec %q to baseline %s", summary.Spec, config.Baseline)
+	}
+	var failed []Regression
+	for _, r := range regressions {
+		utils.Logf("%s: %s", strings.ToUpper(r.Rule.Action), r)
+		for _, w := range summary.Workloads {
+			if w.Cluster == r.Cluster && w.ID == r.Workload {
+				w.Regressions = append(w.Regressions, r.String())
+				w.Regressed = w.Regressed || r.Rule.Action == RegressionFail
+			}
+		}
+		if r.Rule.Action == RegressionFail {
+			failed = append(failed, r)
+		}
+	}
+	return failed, nil
+}
+
+// ExpectNoRegressions fails the spec if there are regressions that breach a rule with RegressionFail, as returned by
+// RecordRegressions.
+func ExpectNoRegressions(config BaselineConfig, failed []Regression) {
+	rendered := make([]string, 0, len(failed))
+	for _, r := range failed {
+		rendered = append(rendered, r.String())
+	}
+	Expect(rendered).To(BeEmpty(), "workload results regressed from baseline %s", config.Baseline)
+}
+
+func (r Regression) String() string {
+	return fmt.Sprintf("%s of workload %q on %s is %g, was %g in run %s, %s is better with a tolerance of %g%%",
+		r.Metric, r.Workload, r.Key, r.Current, r.Previous, r.Baseline, r.Rule.Better, 100*r.Rule.Tolerance)
+}
+
+// matchRegressionRule returns the first rule matching metric.
+func matchRegressionRule(rules []RegressionRule, metric string) (RegressionRule, bool) {
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.Metric, metric); ok {
+			return rule, true
+		}
+	}
+	return RegressionRule{}, false
+}
+
+// regressed tells whether current is worse than previous by more than the tolerance of rule.
+func regressed(rule RegressionRule, previous, current float64) bool {
+	if rule.Better == HigherIsBetter {
+		return current < previous*(1-rule.Tolerance)
+	}
+	return current > previous*(1+rule.Tolerance)
+}
@@ -0,0 +1,197 @@
+package specs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+)
+
+func baselineSpecSummary(started time.Time, throughput, latency, stuck float64) *SpecSummary {
+	s := &SpecSummary{Spec: "With the aks flavor", GinkgoNode: 1, Started: started, Passed: true}
+	s.Clusters = append(s.Clusters, &ClusterSummary{Name: "knarly-e2e-aks", Flavor: "aks", KubernetesVersion: "v1.23.5", SKU: "Standard_D2s_v3", Nodes: 50})
+	w := s.startWorkload("knarly-e2e-aks", DeploymentChurnWorkload+"-1", DeploymentChurnWorkload, map[string]interface{}{"CL2_NAMESPACES": 2})
+	w.measured(map[string]float64{
+		"scheduling_throughput_pods_per_second": throughput,
+		"overall_duration_seconds":              latency * 100,
+		"pod_startup_latency_p99_seconds":       latency,
+		"namespaces_stuck":                      stuck,
+	})
+	w.finish(true)
+	return s
+}
+
+func TestStoreRunResultsAndCompareToBaseline(t *testing.T) {
+	g := NewWithT(t)
+	artifactFolder, resultsDir := t.TempDir(), t.TempDir()
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	g.Expect(WriteSpecSummary(artifactFolder, 1, baselineSpecSummary(start, 20, 4, 0))).To(Succeed())
+	_, err := WriteRunSummary(artifactFolder)
+	g.Expect(err).NotTo(HaveOccurred())
+	records, err := StoreRunResults(resultsDir, artifactFolder)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(records).To(HaveLen(1))
+	g.Expect(records[0].Run).To(Equal("20220301-100000"))
+	g.Expect(records[0].Key.String()).To(Equal("aks/Standard_D2s_v3/50-nodes/v1.23.5"))
+	g.Expect(filepath.Join(resultsDir, "aks", "Standard_D2s_v3", "50-nodes", "v1.23.5", "20220301-100000.json")).To(BeAnExistingFile())
+
+	config := BaselineConfig{ResultsDir: resultsDir, Baseline: LatestBaseline, Rules: DefaultRegressionRules}
+	g.Expect(config.Validate()).To(Succeed())
+
+	// within tolerance
+	regressions, err := CompareToBaseline(config, baselineSpecSummary(start.Add(24*time.Hour), 17, 5, 3))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(regressions).To(BeEmpty())
+
+	// throughput drops by 30%, latency grows by 50%
+	regressions, err = CompareToBaseline(config, baselineSpecSummary(start.Add(24*time.Hour), 14, 6, 0))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(regressions).To(HaveLen(3))
+	g.Expect(regressions[0].Metric).To(Equal("overall_duration_seconds"))
+	g.Expect(regressions[0].Rule.Action).To(Equal(RegressionWarn))
+	g.Expect(regressions[1].Metric).To(Equal("pod_startup_latency_p99_seconds"))
+	g.Expect(regressions[1].Rule.Action).To(Equal(RegressionFail))
+	g.Expect(regressions[2].Metric).To(Equal("scheduling_throughput_pods_per_second"))
+	g.Expect(regressions[2].Previous).To(Equal(20.0))
+	g.Expect(regressions[2].Current).To(Equal(14.0))
+	g.Expect(regressions[2].Baseline).To(Equal("20220301-100000"))
+
+	// a baseline for another key or run doesn't exist
+	other := baselineSpecSummary(start, 1, 100, 0)
+	other.Clusters[0].Nodes = 100
+	regressions, err = CompareToBaseline(config, other)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(regressions).To(BeEmpty())
+	config.Baseline = "20220228-100000"
+	regressions, err = CompareToBaseline(config, baselineSpecSummary(start, 1, 100, 0))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(regressions).To(BeEmpty())
+}
+
+func TestRegressedRunIsNotTheLatestBaseline(t *testing.T) {
+	g := NewWithT(t)
+	resultsDir := t.TempDir()
+	config := BaselineConfig{ResultsDir: resultsDir, Baseline: LatestBaseline, Rules: DefaultRegressionRules}
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	run := func(day int, throughput float64) []Regression {
+		summary := baselineSpecSummary(start.Add(time.Duration(day)*24*time.Hour), throughput, 4, 0)
+		failed, err := RecordRegressions(config, summary)
+		g.Expect(err).NotTo(HaveOccurred())
+		artifactFolder := t.TempDir()
+		g.Expect(WriteSpecSummary(artifactFolder, 1, summary)).To(Succeed())
+		_, err = WriteRunSummary(artifactFolder)
+		g.Expect(err).NotTo(HaveOccurred())
+		_, err = StoreRunResults(resultsDir, artifactFolder)
+		g.Expect(err).NotTo(HaveOccurred())
+		return failed
+	}
+
+	g.Expect(run(0, 20)).To(BeEmpty())
+	// a 30% drop in throughput fails the run and is recorded as a regression
+	failed := run(1, 14)
+	g.Expect(failed).To(HaveLen(1))
+	g.Expect(failed[0].Metric).To(Equal("scheduling_throughput_pods_per_second"))
+	record, err := readBaselineRecord(filepath.Join(resultsDir, "aks", "Standard_D2s_v3", "50-nodes", "v1.23.5", "20220302-100000.json"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(record.Workloads[0].Regressed).To(BeTrue())
+	// so the next run is still compared to the run before it, and fails again
+	failed = run(2, 14)
+	g.Expect(failed).To(HaveLen(1))
+	g.Expect(failed[0].Baseline).To(Equal("20220301-100000"))
+}
+
+func TestCompareToBaselineByRunID(t *testing.T) {
+	g := NewWithT(t)
+	artifactFolder, resultsDir := t.TempDir(), t.TempDir()
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	// the azurefile-csi and azuredisk-csi runs of the same workload, with very different throughput
+	statefulSets := func(started time.Time, azureFile, azureDisk float64) *SpecSummary {
+		s := &SpecSummary{Spec: "With the aks flavor", GinkgoNode: 1, Started: started, Passed: true}
+		s.Clusters = append(s.Clusters, &ClusterSummary{Name: "knarly-e2e-aks", Flavor: "aks", KubernetesVersion: "v1.23.5", SKU: "Standard_D2s_v3", Nodes: 50})
+		for i, throughput := range []float64{azureFile, azureDisk} {
+			w := s.startWorkload("knarly-e2e-aks", fmt.Sprintf("%s-%d", IncrementalScaleWorkload, i+1), IncrementalScaleWorkload, nil)
+			w.measured(map[string]float64{"scheduling_throughput_pods_per_second": throughput})
+			w.finish(true)
+		}
+		return s
+	}
+
+	g.Expect(WriteSpecSummary(artifactFolder, 1, statefulSets(start, 10, 30))).To(Succeed())
+	_, err := WriteRunSummary(artifactFolder)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = StoreRunResults(resultsDir, artifactFolder)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	config := BaselineConfig{ResultsDir: resultsDir, Baseline: LatestBaseline, Rules: DefaultRegressionRules}
+	regressions, err := CompareToBaseline(config, statefulSets(start.Add(24*time.Hour), 10, 30))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(regressions).To(BeEmpty())
+	regressions, err = CompareToBaseline(config, statefulSets(start.Add(24*time.Hour), 10, 20))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(regressions).To(HaveLen(1))
+	g.Expect(regressions[0].Workload).To(Equal("incremental-scale-2"))
+	g.Expect(regressions[0].Previous).To(Equal(30.0))
+}
+
+func TestMatchRegressionRule(t *testing.T) {
+	g := NewWithT(t)
+
+	rule, ok := matchRegressionRule(DefaultRegressionRules, "pod_startup_latency_p99_seconds")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(rule.Action).To(Equal(RegressionFail))
+	rule, ok = matchRegressionRule(DefaultRegressionRules, "watch_delay_p99_seconds")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(rule.Action).To(Equal(RegressionWarn))
+	_, ok = matchRegressionRule(DefaultRegressionRules, "pods_ready")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestBaselineConfigValidate(t *testing.T) {
+	valid := BaselineConfig{ResultsDir: "/results", Baseline: LatestBaseline, Rules: DefaultRegressionRules}
+
+	mutated := func(mutate func(c *BaselineConfig)) BaselineConfig {
+		c := valid
+		mutate(&c)
+		return c
+	}
+	runValidateTests(t, []validateTest{
+		{name: "valid", config: valid},
+		{name: "no results directory", config: mutated(func(c *BaselineConfig) { c.ResultsDir = "" }), wantErr: "ResultsDir"},
+		{name: "malformed metric pattern", config: mutated(func(c *BaselineConfig) {
+			c.Rules = []RegressionRule{{Metric: "[", Better: LowerIsBetter, Action: RegressionWarn}}
+		}), wantErr: "Rules[0].Metric"},
+		{name: "unsupported direction", config: mutated(func(c *BaselineConfig) {
+			c.Rules = []RegressionRule{{Metric: "*", Better: "more", Action: RegressionWarn}}
+		}), wantErr: "Rules[0].Better"},
+		{name: "negative tolerance", config: mutated(func(c *BaselineConfig) {
+			c.Rules = []RegressionRule{{Metric: "*", Better: LowerIsBetter, Tolerance: -0.1, Action: RegressionWarn}}
+		}), wantErr: "Rules[0].Tolerance"},
+		{name: "unsupported action", config: mutated(func(c *BaselineConfig) {
+			c.Rules = []RegressionRule{{Metric: "*", Better: LowerIsBetter, Action: "ignore"}}
+		}), wantErr: "Rules[0].Action"},
+	})
+}
+
+func TestResolveBaselineConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	t.Setenv(utils.ResultsDir, "")
+	config, err := ResolveBaselineConfig(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config).To(BeNil())
+
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	g.Expect(ioutil.WriteFile(rulesPath, []byte("- metric: watch_delay_p99_seconds\n  better: lower\n  tolerance: 0.5\n  action: fail\n"), 0644)).To(Succeed())
+	t.Setenv(utils.ResultsDir, "/results")
+	t.Setenv(utils.Baseline, "20220301-100000")
+	t.Setenv(utils.RegressionRules, rulesPath)
+	config, err = ResolveBaselineConfig(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Baseline).To(Equal("20220301-100000"))
+	g.Expect(config.Rules).To(Equal([]RegressionRule{{Metric: "watch_delay_p99_seconds", Better: LowerIsBetter, Tolerance: 0.5, Action: RegressionFail}}))
+}
@@ -0,0 +1,425 @@
+package specs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/flowcontrol"
+	"sigs.k8s.io/cluster-api/test/framework"
+)
+
+const (
+	// testIDLabel and testRoundLabel match the labels the clusterloader2 workloads put on their pods.
+	testIDLabel    = "test-id"
+	testRoundLabel = "test-round"
+	// nativeChurnImage is the image the clusterloader2 workloads run.
+	nativeChurnImage = "mcr.microsoft.com/oss/kubernetes/pause:3.5"
+	// nativeChurnWorkers bounds the number of API calls in flight, so slow calls don't hold back the target rate.
+	nativeChurnWorkers = 50
+	// nativeChurnPollInterval is how often pods are listed while waiting for them to run.
+	nativeChurnPollInterval = 5 * time.Second
+	// cleanupTimeout bounds deleting what a workload created. Cleanup runs with a context of its own, as the context
+	// of the workload is already done when it timed out or was interrupted.
+	cleanupTimeout = 2 * time.Minute
+
+	// PodControllerPod makes the native churn engine create naked pods.
+	PodControllerPod = "pod"
+	// PodControllerDeployment makes the native churn engine create pods through deployments.
+	PodControllerDeployment = "deployment"
+)
+
+type (
+	// NativeChurnConfig configures RunNativeChurn, following the parameters of the deployment-churn workload.
+	NativeChurnConfig struct {
+		// TestID labels every namespace and object the run creates, and prefixes the namespace names
+		TestID string
+		// Namespaces indicates the number of namespaces to spread objects across
+		Namespaces int
+		// Cleanup explicitly deletes the remaining objects at the target rate before the namespaces are deleted
+		Cleanup bool
+		// NumChurnIterations is the number of churn rounds after the initial round
+		NumChurnIterations int
+		// ChurnFraction is the fraction of objects replaced in each churn round; unset uses 1.0
+		ChurnFraction *float64
+		// PodStartTimeout is how long to wait after each round for its pods to be running; zero skips waiting
+		PodStartTimeout time.Duration
+		// PodsPerNode determines how many pods to keep running, per node
+		PodsPerNode int
+		// NodeCount overrides the node count pods are sized by; unset uses the current node count
+		NodeCount *int
+		// PodChurnRate is the target number of pod creations plus deletions per second
+		PodChurnRate int
+		// PodController is PodControllerPod or PodControllerDeployment
+		PodController string
+		// PodsPerDeployment is the number of replicas of each deployment, when PodController is PodControllerDeployment
+		PodsPerDeployment int
+	}
+
+	// NativeChurnRound records one round of a native churn run.
+	NativeChurnRound struct {
+		// Round is 0 for the initial round, then counts churn rounds, with cleanup last
+		Round int `json:"round"`
+		// Created and Deleted count objects, i.e. pods or deployments
+		Created int `json:"created"`
+		Deleted int `json:"deleted"`
+		// CRUDDuration is how long creating and deleting took
+		CRUDDuration time.Duration `json:"crudDuration"`
+		// WaitDuration is how long it then took for all pods to be running
+		WaitDuration time.Duration `json:"waitDuration"`
+	}
+
+	// NativeChurnResult is the outcome of a native churn run.
+	NativeChurnResult struct {
+		Rounds   []NativeChurnRound `json:"rounds"`
+		Duration time.Duration      `json:"duration"`
+	}
+
+	nativeChurn struct {
+		clientSet     kubernetes.Interface
+		config        NativeChurnConfig
+		podsPerObject int
+		namespaces    []string
+		// live holds the names of the objects in each namespace, oldest first
+		live          map[string][]string
+		createLimiter flowcontrol.RateLimiter
+		deleteLimiter flowcontrol.RateLimiter
+	}
+)
+
+// Validate checks the config for values the native churn engine can't run with.
+func (c NativeChurnConfig) Validate() error {
+	var errs field.ErrorList
+	if c.TestID == "" {
+		errs = append(errs, field.Required(field.NewPath("TestID"), "is used to name and label namespaces"))
+	}
+	errs = append(errs, validatePositive(field.NewPath("Namespaces"), c.Namespaces)...)
+	if c.NumChurnIterations < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("NumChurnIterations"), c.NumChurnIterations, "must not be negative"))
+	}
+	if c.ChurnFraction != nil && (*c.ChurnFraction <= 0 || *c.ChurnFraction > 1) {
+		errs = append(errs, field.Invalid(field.NewPath("ChurnFraction"), *c.ChurnFraction, "must be greater than 0 and at most 1.0"))
+	}
+	if c.PodStartTimeout < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("PodStartTimeout"), c.PodStartTimeout, "must not be negative"))
+	}
+	errs = append(errs, validatePositive(field.NewPath("PodsPerNode"), c.PodsPerNode)...)
+	if c.NodeCount != nil {
+		errs = append(errs, validatePositive(field.NewPath("NodeCount"), *c.NodeCount)...)
+	}
+	errs = append(errs, validatePositive(field.NewPath("PodChurnRate"), c.PodChurnRate)...)
+	errs = append(errs, validateOneOf(field.NewPath("PodController"), c.PodController, []string{PodControllerPod, PodControllerDeployment})...)
+	if c.PodController == PodControllerDeployment {
+		errs = append(errs, validatePositive(field.NewPath("PodsPerDeployment"), c.PodsPerDeployment)...)
+	}
+	return errs.ToAggregate()
+}
+
+// RunNativeChurnTest runs the native churn engine against any cluster, e.g. a workload cluster or a local kind
+// cluster, and fails the spec if the run fails.
+func RunNativeChurnTest(ctx context.Context, clusterProxy framework.ClusterProxy, config NativeChurnConfig) *NativeChurnResult {
+	specName := "run-native-churn-tests"
+	Expect(clusterProxy).NotTo(BeNil(), "Invalid argument. clusterProxy can't be nil when calling %s spec", specName)
+	result, err := RunNativeChurn(ctx, clusterProxy.GetClientSet(), config)
+	Expect(err).ToNot(HaveOccurred(), "native churn failed against cluster %s", clusterProxy.GetName())
+	return result
+}
+
+// RunNativeChurn creates and deletes pods or deployments through clientSet the way the deployment-churn workload
+// does: an initial round, NumChurnIterations churn rounds replacing ChurnFraction of the objects, and an optional
+// cleanup round. Creations and deletions are each rate limited to half of PodChurnRate.
+func RunNativeChurn(ctx context.Context, clientSet kubernetes.Interface, config NativeChurnConfig) (*NativeChurnResult, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid native churn config")
+	}
+	nodeCount, err := churnNodeCount(ctx, clientSet, config.NodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &nativeChurn{
+		clientSet:     clientSet,
+		config:        config,
+		podsPerObject: 1,
+		live:          map[string][]string{},
+	}
+	if config.PodController == PodControllerDeployment {
+		c.podsPerObject = config.PodsPerDeployment
+	}
+	desiredObjects := maxInt(1, nodeCount*config.PodsPerNode/c.podsPerObject)
+	objectsPerNamespace := maxInt(1, desiredObjects/config.Namespaces)
+	churnFraction := 1.0
+	if config.ChurnFraction != nil {
+		churnFraction = *config.ChurnFraction
+	}
+	objectsToRecreate := int(float64(objectsPerNamespace) * churnFraction)
+	// half of the churn comes from creations and half from deletions, each with its own bucket so neither starves the other
+	objectsPerSecond := float32(config.PodChurnRate) / 2 / float32(c.podsPerObject)
+	c.createLimiter = flowcontrol.NewTokenBucketRateLimiter(objectsPerSecond, 1)
+	c.deleteLimiter = flowcontrol.NewTokenBucketRateLimiter(objectsPerSecond, 1)
+	defer c.createLimiter.Stop()
+	defer c.deleteLimiter.Stop()
+
+	utils.Logf("native churn %q: %d %ss per namespace across %d namespaces, %d replaced per churn round, %.2f creations/s, %d nodes",
+		config.TestID, objectsPerNamespace, config.PodController, config.Namespaces, objectsToRecreate, objectsPerSecond, nodeCount)
+
+	start := time.Now()
+	result := &NativeChurnResult{}
+	if err := c.createNamespaces(ctx); err != nil {
+		return nil, err
+	}
+	defer c.deleteNamespaces()
+
+	round, err := c.runRound(ctx, 0, 0, objectsPerNamespace, true)
+	result.Rounds = append(result.Rounds, round)
+	if err != nil {
+		return result, err
+	}
+	for i := 1; i <= config.NumChurnIterations; i++ {
+		round, err := c.runRound(ctx, i, objectsToRecreate, objectsToRecreate, true)
+		result.Rounds = append(result.Rounds, round)
+		if err != nil {
+			return result, err
+		}
+	}
+	if config.Cleanup {
+		round, err := c.runRound(ctx, config.NumChurnIterations+1, objectsPerNamespace, 0, false)
+		result.Rounds = append(result.Rounds, round)
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Duration = time.Since(start)
+	utils.Logf("native churn %q finished in %s", config.TestID, result.Duration.Round(time.Second))
+	return result, nil
+}
+
+// runRound concurrently deletes the oldest deletes objects and creates creates new ones in every namespace, and then
+// optionally waits for the pods of all live objects to be running.
+func (c *nativeChurn) runRound(ctx context.Context, round, deletes, creates int, wait bool) (NativeChurnRound, error) {
+	result := NativeChurnRound{Round: round}
+	var deleteOps, createOps []func(context.Context) error
+	for _, ns := range c.namespaces {
+		ns := ns
+		n := minInt(deletes, len(c.live[ns]))
+		for _, name := range c.live[ns][:n] {
+			name := name
+			deleteOps = append(deleteOps, func(ctx context.Context) error { return c.deleteObject(ctx, ns, name) })
+		}
+		var created []string
+		for i := 0; i < creates; i++ {
+			name := fmt.Sprintf("%s-rnd-%d-%d", c.config.PodController, round, i)
+			created = append(created, name)
+			createOps = append(createOps, func(ctx context.Context) error { return c.createObject(ctx, ns, name, round) })
+		}
+		c.live[ns] = append(c.live[ns][n:], created...)
+	}
+	result.Created, result.Deleted = len(createOps), len(deleteOps)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	var deleteErr, createErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		deleteErr = runRateLimited(ctx, c.deleteLimiter, deleteOps)
+	}()
+	go func() {
+		defer wg.Done()
+		createErr = runRateLimited(ctx, c.createLimiter, createOps)
+	}()
+	wg.Wait()
+	result.CRUDDuration = time.Since(start)
+	if err := utilerrors.NewAggregate([]error{deleteErr, createErr}); err != nil {
+		return result, errors.Wrapf(err, "churn round %d", round)
+	}
+
+	if wait && c.config.PodStartTimeout > 0 {
+		start = time.Now()
+		err := c.waitForRunningPods(ctx)
+		result.WaitDuration = time.Since(start)
+		if err != nil {
+			return result, errors.Wrapf(err, "waiting for pods of churn round %d", round)
+		}
+	}
+	utils.Logf("native churn %q round %d: created %d, deleted %d in %s, pods running after a further %s",
+		c.config.TestID, round, result.Created, result.Deleted, result.CRUDDuration.Round(time.Millisecond), result.WaitDuration.Round(time.Millisecond))
+	return result, nil
+}
+
+func (c *nativeChurn) createNamespaces(ctx context.Context) error {
+	for i := 1; i <= c.config.Namespaces; i++ {
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   fmt.Sprintf("%s-%d", c.config.TestID, i),
+				Labels: map[string]string{testIDLabel: c.config.TestID},
+			},
+		}
+		if _, err := c.clientSet.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil {
+			return errors.Wrapf(err, "creating namespace %s", ns.Name)
+		}
+		c.namespaces = append(c.namespaces, ns.Name)
+	}
+	return nil
+}
+
+func (c *nativeChurn) deleteNamespaces() {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	for _, ns := range c.namespaces {
+		if err := c.clientSet.CoreV1().Namespaces().Delete(ctx, ns, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			// Failing to delete namespaces should not hide the result of the run
+			utils.Logf("failed to delete native churn namespace %s: %v", ns, err)
+		}
+	}
+}
+
+func (c *nativeChurn) createObject(ctx context.Context, ns, name string, round int) error {
+	labels := map[string]string{
+		testIDLabel:    c.config.TestID,
+		testRoundLabel: fmt.Sprintf("r%d", round),
+	}
+	podSpec := corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "load-test", Image: nativeChurnImage}},
+	}
+	var err error
+	switch c.config.PodController {
+	case PodControllerDeployment:
+		replicas := int32(c.podsPerObject)
+		selector := map[string]string{"name": name}
+		templateLabels := map[string]string{"name": name}
+		for k, v := range labels {
+			templateLabels[k] = v
+		}
+		_, err = c.clientSet.AppsV1().Deployments(ns).Create(ctx, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: selector},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: templateLabels},
+					Spec:       podSpec,
+				},
+			},
+		}, metav1.CreateOptions{})
+	default:
+		_, err = c.clientSet.CoreV1().Pods(ns).Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Spec:       podSpec,
+		}, metav1.CreateOptions{})
+	}
+	return errors.Wrapf(err, "creating %s %s/%s", c.config.PodController, ns, name)
+}
+
+func (c *nativeChurn) deleteObject(ctx context.Context, ns, name string) error {
+	var err error
+	switch c.config.PodController {
+	case PodControllerDeployment:
+		err = c.clientSet.AppsV1().Deployments(ns).Delete(ctx, name, metav1.DeleteOptions{})
+	default:
+		err = c.clientSet.CoreV1().Pods(ns).Delete(ctx, name, metav1.DeleteOptions{})
+	}
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return errors.Wrapf(err, "deleting %s %s/%s", c.config.PodController, ns, name)
+}
+
+// waitForRunningPods waits until exactly the pods of the live objects are running, ignoring pods being deleted.
+func (c *nativeChurn) waitForRunningPods(ctx context.Context) error {
+	want := 0
+	for _, names := range c.live {
+		want += len(names) * c.podsPerObject
+	}
+	selector := fmt.Sprintf("%s=%s", testIDLabel, c.config.TestID)
+	return wait.PollImmediate(nativeChurnPollInterval, c.config.PodStartTimeout, func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		running := 0
+		for _, ns := range c.namespaces {
+			pods, err := c.clientSet.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				utils.Logf("failed to list pods in %s, retrying: %v", ns, err)
+				return false, nil
+			}
+			for _, pod := range pods.Items {
+				if pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning {
+					running++
+				}
+			}
+		}
+		return running == want, nil
+	})
+}
+
+// runRateLimited runs ops as fast as limiter allows, with at most nativeChurnWorkers in flight at once.
+func runRateLimited(ctx context.Context, limiter flowcontrol.RateLimiter, ops []func(context.Context) error) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		sem  = make(chan struct{}, nativeChurnWorkers)
+	)
+	for _, op := range ops {
+		if err := limiter.Wait(ctx); err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(op func(context.Context) error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := op(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(op)
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
+
+func churnNodeCount(ctx context.Context, clientSet kubernetes.Interface, nodeCount *int) (int, error) {
+	if nodeCount != nil {
+		return *nodeCount, nil
+	}
+	nodes, err := clientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, errors.Wrap(err, "listing nodes")
+	}
+	if len(nodes.Items) == 0 {
+		return 0, errors.New("cluster has no nodes to size the churn by")
+	}
+	return len(nodes.Items), nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
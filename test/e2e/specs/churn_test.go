@@ -0,0 +1,113 @@
+package specs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/utils/pointer"
+)
+
+func TestRunNativeChurnPods(t *testing.T) {
+	g := NewWithT(t)
+	clientSet := fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}},
+	)
+	var creates, deletes int
+	clientSet.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		creates++
+		return false, nil, nil
+	})
+	clientSet.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deletes++
+		return false, nil, nil
+	})
+
+	result, err := RunNativeChurn(context.Background(), clientSet, NativeChurnConfig{
+		TestID:             "churn",
+		Namespaces:         2,
+		Cleanup:            true,
+		NumChurnIterations: 2,
+		PodsPerNode:        3,
+		PodChurnRate:       1000,
+		PodController:      PodControllerPod,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// 2 nodes x 3 pods spread across 2 namespaces, all replaced in each of the 2 churn rounds, then cleaned up
+	g.Expect(result.Rounds).To(HaveLen(4))
+	g.Expect(result.Rounds[0]).To(And(HaveField("Created", 6), HaveField("Deleted", 0)))
+	g.Expect(result.Rounds[1]).To(And(HaveField("Created", 6), HaveField("Deleted", 6)))
+	g.Expect(result.Rounds[3]).To(And(HaveField("Created", 0), HaveField("Deleted", 6)))
+	g.Expect(creates).To(Equal(18))
+	g.Expect(deletes).To(Equal(18))
+	pods, err := clientSet.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pods.Items).To(BeEmpty())
+	namespaces, err := clientSet.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(namespaces.Items).To(BeEmpty())
+}
+
+func TestRunNativeChurnDeploymentsWithChurnFraction(t *testing.T) {
+	g := NewWithT(t)
+	clientSet := fake.NewSimpleClientset()
+
+	result, err := RunNativeChurn(context.Background(), clientSet, NativeChurnConfig{
+		TestID:             "churn",
+		Namespaces:         1,
+		NumChurnIterations: 1,
+		ChurnFraction:      pointer.Float64(0.5),
+		PodsPerNode:        10,
+		NodeCount:          pointer.Int(4),
+		PodChurnRate:       1000,
+		PodController:      PodControllerDeployment,
+		PodsPerDeployment:  5,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Rounds).To(HaveLen(2))
+	g.Expect(result.Rounds[1]).To(And(HaveField("Created", 4), HaveField("Deleted", 4)))
+
+	// the namespace is deleted at the end, but the fake clientset doesn't cascade that to its deployments
+	deployments, err := clientSet.AppsV1().Deployments("churn-1").List(context.Background(), metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	var live []string
+	for _, d := range deployments.Items {
+		live = append(live, d.Name)
+		g.Expect(*d.Spec.Replicas).To(BeEquivalentTo(5))
+		g.Expect(d.Spec.Template.Labels).To(HaveKeyWithValue(testIDLabel, "churn"))
+	}
+	g.Expect(live).To(ConsistOf(
+		"deployment-rnd-0-4", "deployment-rnd-0-5", "deployment-rnd-0-6", "deployment-rnd-0-7",
+		"deployment-rnd-1-0", "deployment-rnd-1-1", "deployment-rnd-1-2", "deployment-rnd-1-3",
+	))
+}
+
+func TestRunNativeChurnWaitsForRunningPods(t *testing.T) {
+	g := NewWithT(t)
+	clientSet := fake.NewSimpleClientset()
+	// pods start running as soon as they are created
+	clientSet.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		action.(k8stesting.CreateAction).GetObject().(*corev1.Pod).Status.Phase = corev1.PodRunning
+		return false, nil, nil
+	})
+
+	_, err := RunNativeChurn(context.Background(), clientSet, NativeChurnConfig{
+		TestID:             "churn",
+		Namespaces:         1,
+		NumChurnIterations: 1,
+		PodStartTimeout:    time.Minute,
+		PodsPerNode:        2,
+		NodeCount:          pointer.Int(1),
+		PodChurnRate:       1000,
+		PodController:      PodControllerPod,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+}
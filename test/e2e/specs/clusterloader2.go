@@ -0,0 +1,110 @@
+package specs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/test/framework/clusterctl"
+)
+
+const (
+	// clusterLoader2BinaryName is the name clusterloader2 is looked up by on PATH.
+	clusterLoader2BinaryName = "clusterloader2"
+	// perfTestsClusterLoader2Path is where CI builds clusterloader2, relative to the repository root.
+	perfTestsClusterLoader2Path = "perf-tests/clusterloader2/cmd/clusterloader"
+	// workloadsPath is where the clusterloader2 workload configs live, relative to the repository root.
+	workloadsPath = "test/workloads"
+)
+
+// ClusterLoader2 locates the clusterloader2 binary and the workload configs it runs.
+type ClusterLoader2 struct {
+	// BinaryPath is the absolute path to the clusterloader2 binary
+	BinaryPath string
+	// RootPath is the absolute path to the repository root, which contains test/workloads
+	RootPath string
+}
+
+// ResolveClusterLoader2 finds the repository root and the clusterloader2 binary.
+// The root is taken from the KNARLY_ROOT variable, or else found by walking up from the working directory.
+// The binary is taken from the CLUSTERLOADER2_PATH variable, or else looked up on PATH, or else in the perf-tests checkout under the root.
+func ResolveClusterLoader2(e2eConfig *clusterctl.E2EConfig) (*ClusterLoader2, error) {
+	rootPath, err := resolveRootPath(e2eConfig)
+	if err != nil {
+		return nil, err
+	}
+	binaryPath, err := resolveClusterLoader2Binary(e2eConfig, rootPath)
+	if err != nil {
+		return nil, err
+	}
+	utils.Logf("using clusterloader2 binary %s with workloads from %s", binaryPath, filepath.Join(rootPath, workloadsPath))
+	return &ClusterLoader2{
+		BinaryPath: binaryPath,
+		RootPath:   rootPath,
+	}, nil
+}
+
+// WorkloadConfig returns the absolute path of a workload config given relative to test/workloads.
+func (c *ClusterLoader2) WorkloadConfig(configPath string) (string, error) {
+	absPath := filepath.Join(c.RootPath, workloadsPath, configPath)
+	if _, err := os.Stat(absPath); err != nil {
+		return "", errors.Wrapf(err, "finding workload config %s", configPath)
+	}
+	return absPath, nil
+}
+
+func resolveRootPath(e2eConfig *clusterctl.E2EConfig) (string, error) {
+	if e2eConfig != nil && e2eConfig.HasVariable(utils.KnarlyRootPath) {
+		rootPath, err := filepath.Abs(e2eConfig.GetVariable(utils.KnarlyRootPath))
+		if err != nil {
+			return "", errors.Wrapf(err, "resolving %s", utils.KnarlyRootPath)
+		}
+		if !isDir(filepath.Join(rootPath, workloadsPath)) {
+			return "", errors.Errorf("%s is set to %s, but %s does not exist there", utils.KnarlyRootPath, rootPath, workloadsPath)
+		}
+		return rootPath, nil
+	}
+
+	// ginkgo runs the suite from the test/e2e package directory, so the root is usually a couple of levels up
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", errors.Wrap(err, "getting working directory")
+	}
+	for {
+		if isDir(filepath.Join(dir, workloadsPath)) {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.Errorf("could not find %s above the working directory, set %s to the repository root", workloadsPath, utils.KnarlyRootPath)
+		}
+		dir = parent
+	}
+}
+
+func resolveClusterLoader2Binary(e2eConfig *clusterctl.E2EConfig, rootPath string) (string, error) {
+	if e2eConfig != nil && e2eConfig.HasVariable(utils.ClusterLoader2Path) && e2eConfig.GetVariable(utils.ClusterLoader2Path) != "" {
+		binaryPath, err := exec.LookPath(e2eConfig.GetVariable(utils.ClusterLoader2Path))
+		if err != nil {
+			return "", errors.Wrapf(err, "%s does not point to an executable", utils.ClusterLoader2Path)
+		}
+		return filepath.Abs(binaryPath)
+	}
+
+	if binaryPath, err := exec.LookPath(clusterLoader2BinaryName); err == nil {
+		return filepath.Abs(binaryPath)
+	}
+
+	binaryPath := filepath.Join(rootPath, perfTestsClusterLoader2Path)
+	if _, err := exec.LookPath(binaryPath); err != nil {
+		return "", errors.Errorf("could not find clusterloader2: set %s, put %s on PATH, or build it at %s", utils.ClusterLoader2Path, clusterLoader2BinaryName, binaryPath)
+	}
+	return binaryPath, nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,516 @@
+package specs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	// CustomObjectScaleWorkload names the measurements of the custom object scale workload, which runs without
+	// clusterloader2.
+	CustomObjectScaleWorkload = "custom-object-scale"
+
+	// customObjectEstablishTimeout bounds how long to wait for the API server to serve the synthetic CRD.
+	customObjectEstablishTimeout = time.Minute
+	// customObjectStorageTimeout bounds how long to wait for apiserver_storage_objects to catch up with the objects.
+	customObjectStorageTimeout = 2 * time.Minute
+	// customObjectLeftoverTimeout bounds how long to wait for the API server to delete a synthetic CRD left over from an
+	// earlier run, along with its custom objects.
+	customObjectLeftoverTimeout = 5 * time.Minute
+)
+
+// customObjectResource is the synthetic custom resource the custom object scale workload creates.
+var customObjectResource = schema.GroupVersionResource{Group: "knarly.azure.com", Version: "v1", Resource: "scaleobjects"}
+
+type (
+	// CustomObjectScaleConfig configures a CustomObjectScale.
+	CustomObjectScaleConfig struct {
+		// TestID labels every namespace and object the run creates, and prefixes the namespace names
+		TestID string
+		// Namespaces indicates the number of namespaces to spread the custom objects across
+		Namespaces int
+		// ObjectsPerNamespace is the number of custom objects in each namespace
+		ObjectsPerNamespace int
+		// ObjectSizeBytes is the size of the data in the spec of each custom object
+		ObjectSizeBytes int
+		// UpdatesPerObject is the number of times every custom object is updated, zero skips updating
+		UpdatesPerObject int
+		// OperationRate is the target number of creations, updates and deletions per second
+		OperationRate int
+		// TargetCountTimeout is how long to wait for all custom objects to be listed after creating them
+		TargetCountTimeout time.Duration
+		// SLO declares the thresholds the results must meet for the spec to pass
+		SLO CustomObjectScaleSLO
+	}
+
+	// CustomObjectScaleSLO declares the thresholds the results of a CustomObjectScale must meet, zero values are not
+	// checked.
+	CustomObjectScaleSLO struct {
+		// MaxLatencyP99 is the maximum 99th percentile latency of creating, updating and deleting custom objects
+		MaxLatencyP99 time.Duration
+	}
+
+	// CustomObjectScaleResults are the measurements of a CustomObjectScale.
+	CustomObjectScaleResults struct {
+		// Resource is the custom resource, e.g. "scaleobjects.knarly.azure.com"
+		Resource string `json:"resource"`
+		// Objects is the target number of custom objects
+		Objects int `json:"objects"`
+		// Created, Updated and Deleted count the successful operations
+		Created int `json:"created"`
+		Updated int `json:"updated"`
+		Deleted int `json:"deleted"`
+		// TimeToTargetCount is the time from starting to create the custom objects to listing all of them
+		TimeToTargetCount time.Duration `json:"timeToTargetCount"`
+		// Latency maps "create", "update" and "delete" to the percentiles of their latency as seen by the client
+		Latency map[string]LatencyPercentiles `json:"latency"`
+		// APIServerLatency are the latencies of the requests for the custom resource as seen by the API server, empty
+		// if its metrics couldn't be scraped
+		APIServerLatency []APIServerLatency `json:"apiServerLatency,omitempty"`
+		// StorageObjects is the number of custom objects in etcd once the target count was reached, according to the
+		// apiserver_storage_objects metric, nil if it couldn't be scraped
+		StorageObjects *int64 `json:"storageObjects,omitempty"`
+		// TotalStorageObjects is the number of objects of all resources in etcd at the same time, nil if it couldn't be
+		// scraped
+		TotalStorageObjects *int64 `json:"totalStorageObjects,omitempty"`
+	}
+
+	// CustomObjectScale installs a synthetic CRD and creates, updates and deletes its custom objects at a target rate.
+	CustomObjectScale struct {
+		clientSet     kubernetes.Interface
+		apiExtensions apiextensionsclientset.Interface
+		dynamicClient dynamic.Interface
+		config        CustomObjectScaleConfig
+
+		mu        sync.Mutex
+		results   CustomObjectScaleResults
+		latencies map[string][]time.Duration
+	}
+)
+
+// Validate checks the config for values a CustomObjectScale can't run with.
+func (c CustomObjectScaleConfig) Validate() error {
+	var errs field.ErrorList
+	if c.TestID == "" {
+		errs = append(errs, field.Required(field.NewPath("TestID"), "is used to name and label namespaces"))
+	}
+	errs = append(errs, validatePositive(field.NewPath("Namespaces"), c.Namespaces)...)
+	errs = append(errs, validatePositive(field.NewPath("ObjectsPerNamespace"), c.ObjectsPerNamespace)...)
+	errs = append(errs, validatePositive(field.NewPath("ObjectSizeBytes"), c.ObjectSizeBytes)...)
+	if c.UpdatesPerObject < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("UpdatesPerObject"), c.UpdatesPerObject, "must not be negative"))
+	}
+	errs = append(errs, validatePositive(field.NewPath("OperationRate"), c.OperationRate)...)
+	if c.TargetCountTimeout <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("TargetCountTimeout"), c.TargetCountTimeout, "must be greater than zero"))
+	}
+	return errs.ToAggregate()
+}
+
+// RunCustomObjectScaleTest runs the custom object scale workload against the input cluster, writes its results to
+// custom-object-scale.json among the measurements of the cluster, and fails the spec if the run fails or the results
+// breach the SLO.
+func RunCustomObjectScaleTest(ctx context.Context, input ClusterTestInput, config CustomObjectScaleConfig) *CustomObjectScaleResults {
+	specName := "run-custom-object-scale-tests"
+	Expect(input.BootstrapClusterProxy).NotTo(BeNil(), "Invalid argument. input.BootstrapClusterProxy can't be nil when calling %s spec", specName)
+	Expect(input.Cluster).NotTo(BeNil(), "Invalid argument. input.Cluster can't be nil when calling %s spec", specName)
+	Expect(input.ArtifactFolder).NotTo(BeEmpty(), "Invalid argument. input.ArtifactFolder can't be empty when calling %s spec", specName)
+	Expect(config.Validate()).To(Succeed(), "Invalid parameters for workload %q", CustomObjectScaleWorkload)
+
+	clusterProxy := input.BootstrapClusterProxy.GetWorkloadCluster(ctx, input.Cluster.Namespace, input.Cluster.Name)
+	// the default client side rate limit would throttle the operations far below the target rate
+	restConfig := rest.CopyConfig(clusterProxy.GetRESTConfig())
+	restConfig.QPS = float32(2 * config.OperationRate)
+	restConfig.Burst = 2 * config.OperationRate
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	Expect(err).ToNot(HaveOccurred())
+	apiExtensions, err := apiextensionsclientset.NewForConfig(restConfig)
+	Expect(err).ToNot(HaveOccurred())
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	Expect(err).ToNot(HaveOccurred())
+
+	// API server metrics are nice to have, not being able to scrape them should not fail the workload
+	apiServerBefore, err := ScrapeAPIServerLatency(ctx, clientSet)
+	if err != nil {
+		utils.Logf("not measuring API server latency of workload %q: %v", CustomObjectScaleWorkload, err)
+	}
+	runID := workloadRunID(input, CustomObjectScaleWorkload)
+	summary := input.Summary.startWorkload(input.Cluster.Name, runID, CustomObjectScaleWorkload, config)
+	passed := false
+	defer func() { summary.finish(passed) }()
+	eventsCtx, stopEventInformer := context.WithCancel(ctx)
+	defer stopEventInformer()
+	stopRecordingEvents := recordWorkloadEvents(eventsCtx, informers.NewSharedInformerFactory(clusterProxy.GetClientSet(), 0), input, runID)
+	defer stopRecordingEvents()
+	stopSamplingNodes := recordWorkloadNodeResources(ctx, clusterProxy.GetClientSet(), input, runID)
+	defer stopSamplingNodes()
+	s := NewCustomObjectScale(clientSet, apiExtensions, dynamicClient, config)
+	// uninstalling tolerates what Install didn't get to create, so it also cleans up after a partial install
+	defer s.Uninstall()
+	Expect(s.Install(ctx)).To(Succeed(), "Failed to install the custom resource of workload %q", CustomObjectScaleWorkload)
+	runErr := s.Create(ctx)
+	if runErr == nil {
+		s.scrapeStorageObjects(ctx)
+		runErr = s.Update(ctx)
+	}
+	if runErr == nil {
+		runErr = s.Delete(ctx)
+	}
+	results := s.Results()
+	summary.measured(stopSamplingNodes().summaryMeasurements())
+	if apiServerBefore != nil {
+		if apiServerAfter, err := ScrapeAPIServerLatency(ctx, clientSet); err != nil {
+			utils.Logf("not measuring API server latency of workload %q: %v", CustomObjectScaleWorkload, err)
+		} else {
+			for _, latency := range DiffAPIServerLatency(apiServerBefore, apiServerAfter) {
+				if latency.Group == customObjectResource.Group && latency.Resource == customObjectResource.Resource {
+					results.APIServerLatency = append(results.APIServerLatency, latency)
+				}
+			}
+		}
+	}
+
+	summary.measured(results.summaryMeasurements())
+
+	measurementsDir := workloadMeasurementsDir(input, runID)
+	Expect(writeJSON(filepath.Join(measurementsDir, "custom-object-scale.json"), results)).To(Succeed())
+	Expect(runErr).ToNot(HaveOccurred(), "custom object scale workload failed against cluster %s", clusterProxy.GetName())
+	ExpectCustomObjectScaleSLOs(results, config.SLO)
+	passed = true
+	return results
+}
+
+// NewCustomObjectScale returns a custom object scale run against the cluster the clients talk to.
+func NewCustomObjectScale(clientSet kubernetes.Interface, apiExtensions apiextensionsclientset.Interface, dynamicClient dynamic.Interface, config CustomObjectScaleConfig) *CustomObjectScale {
+	return &CustomObjectScale{
+		clientSet:     clientSet,
+		apiExtensions: apiExtensions,
+		dynamicClient: dynamicClient,
+		config:        config,
+		results: CustomObjectScaleResults{
+			Resource: customObjectResource.GroupResource().String(),
+			Objects:  config.Namespaces * config.ObjectsPerNamespace,
+		},
+		latencies: map[string][]time.Duration{},
+	}
+}
+
+// Install creates the synthetic CRD and the namespaces, and waits for the API server to serve the custom resource.
+func (s *CustomObjectScale) Install(ctx context.Context) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   customObjectResource.GroupResource().String(),
+			Labels: map[string]string{testIDLabel: s.config.TestID},
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: customObjectResource.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:   customObjectResource.Resource,
+				Singular: "scaleobject",
+				Kind:     "ScaleObject",
+				ListKind: "ScaleObjectList",
+			},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    customObjectResource.Version,
+				Served:  true,
+				Storage: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"spec": {
+								Type: "object",
+								Properties: map[string]apiextensionsv1.JSONSchemaProps{
+									"data":     {Type: "string"},
+									"revision": {Type: "integer"},
+								},
+							},
+						},
+					},
+				},
+			}},
+		},
+	}
+	crds := s.apiExtensions.ApiextensionsV1().CustomResourceDefinitions()
+	_, err := crds.Create(ctx, crd, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// left over from an earlier run that didn't get to clean up, its custom objects would skew the counts
+		utils.Logf("deleting CRD %s left over from an earlier run", crd.Name)
+		if err := s.deleteCRD(ctx, customObjectLeftoverTimeout); err != nil {
+			return err
+		}
+		_, err = crds.Create(ctx, crd, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "creating CRD %s", crd.Name)
+	}
+	err = wait.PollImmediate(time.Second, customObjectEstablishTimeout, func() (bool, error) {
+		crd, err := crds.Get(ctx, crd.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		for _, c := range crd.Status.Conditions {
+			if c.Type == apiextensionsv1.Established && c.Status == apiextensionsv1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "waiting for CRD %s to be established", crd.Name)
+	}
+
+	for _, name := range s.namespaces() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{testIDLabel: s.config.TestID}}}
+		if _, err := s.clientSet.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil {
+			return errors.Wrapf(err, "creating namespace %s", name)
+		}
+	}
+	return nil
+}
+
+// Create creates the custom objects at OperationRate, and waits until all of them are listed.
+func (s *CustomObjectScale) Create(ctx context.Context) error {
+	data := strings.Repeat("x", s.config.ObjectSizeBytes)
+	start := time.Now()
+	err := s.forEachObject(ctx, "create", func(ctx context.Context, client dynamic.ResourceInterface, ns, name string) error {
+		object := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": customObjectResource.GroupVersion().String(),
+			"kind":       "ScaleObject",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": ns,
+				"labels":    map[string]interface{}{testIDLabel: s.config.TestID},
+			},
+			"spec": map[string]interface{}{"data": data, "revision": int64(0)},
+		}}
+		_, err := client.Create(ctx, object, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = wait.PollImmediate(time.Second, s.config.TargetCountTimeout, func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		count, err := s.count(ctx)
+		if err != nil {
+			utils.Logf("failed to count %s, retrying: %v", s.results.Resource, err)
+			return false, nil
+		}
+		return count >= s.results.Objects, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "waiting for %d %s to be listed", s.results.Objects, s.results.Resource)
+	}
+	s.mu.Lock()
+	s.results.TimeToTargetCount = time.Since(start)
+	s.mu.Unlock()
+	utils.Logf("reached %d %s in %s", s.results.Objects, s.results.Resource, s.results.TimeToTargetCount)
+	return nil
+}
+
+// Update updates every custom object UpdatesPerObject times at OperationRate.
+func (s *CustomObjectScale) Update(ctx context.Context) error {
+	for revision := 1; revision <= s.config.UpdatesPerObject; revision++ {
+		patch := []byte(fmt.Sprintf(`{"spec":{"revision":%d}}`, revision))
+		err := s.forEachObject(ctx, "update", func(ctx context.Context, client dynamic.ResourceInterface, _, name string) error {
+			_, err := client.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes the custom objects at OperationRate.
+func (s *CustomObjectScale) Delete(ctx context.Context) error {
+	return s.forEachObject(ctx, "delete", func(ctx context.Context, client dynamic.ResourceInterface, _, name string) error {
+		return client.Delete(ctx, name, metav1.DeleteOptions{})
+	})
+}
+
+// Uninstall deletes the CRD, along with any custom objects left, and the namespaces.
+func (s *CustomObjectScale) Uninstall() {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	// Failing to clean up should not hide the result of the run
+	name := customObjectResource.GroupResource().String()
+	if err := s.apiExtensions.ApiextensionsV1().CustomResourceDefinitions().Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		utils.Logf("failed to delete CRD %s: %v", name, err)
+	}
+	for _, ns := range s.namespaces() {
+		if err := s.clientSet.CoreV1().Namespaces().Delete(ctx, ns, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			utils.Logf("failed to delete custom object scale namespace %s: %v", ns, err)
+		}
+	}
+}
+
+// deleteCRD deletes the synthetic CRD, and waits up to timeout until the API server has removed it.
+func (s *CustomObjectScale) deleteCRD(ctx context.Context, timeout time.Duration) error {
+	crds := s.apiExtensions.ApiextensionsV1().CustomResourceDefinitions()
+	name := customObjectResource.GroupResource().String()
+	if err := crds.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "deleting CRD %s", name)
+	}
+	err := wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		_, err := crds.Get(ctx, name, metav1.GetOptions{})
+		return apierrors.IsNotFound(err), nil
+	})
+	return errors.Wrapf(err, "waiting for CRD %s to be deleted", name)
+}
+
+// Results returns the measurements so far.
+func (s *CustomObjectScale) Results() *CustomObjectScaleResults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := s.results
+	results.Latency = map[string]LatencyPercentiles{}
+	for verb, latencies := range s.latencies {
+		results.Latency[verb] = latencyPercentiles(latencies)
+	}
+	return &results
+}
+
+func (s *CustomObjectScale) namespaces() []string {
+	var namespaces []string
+	for i := 1; i <= s.config.Namespaces; i++ {
+		namespaces = append(namespaces, fmt.Sprintf("%s-%d", s.config.TestID, i))
+	}
+	return namespaces
+}
+
+// forEachObject runs op for every custom object at OperationRate, round robin across namespaces, and records its
+// latency under verb. Objects already gone count as done.
+func (s *CustomObjectScale) forEachObject(ctx context.Context, verb string, op func(ctx context.Context, client dynamic.ResourceInterface, ns, name string) error) error {
+	var ops []func(context.Context) error
+	for i := 0; i < s.config.ObjectsPerNamespace; i++ {
+		name := fmt.Sprintf("scaleobject-%d", i)
+		for _, ns := range s.namespaces() {
+			client := s.dynamicClient.Resource(customObjectResource).Namespace(ns)
+			ns := ns
+			ops = append(ops, func(ctx context.Context) error {
+				start := time.Now()
+				err := op(ctx, client, ns, name)
+				latency := time.Since(start)
+				if apierrors.IsNotFound(err) && verb != "create" {
+					return nil
+				}
+				if err != nil {
+					return errors.Wrapf(err, "%s %s %s/%s", verb, s.results.Resource, ns, name)
+				}
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				s.latencies[verb] = append(s.latencies[verb], latency)
+				switch verb {
+				case "create":
+					s.results.Created++
+				case "update":
+					s.results.Updated++
+				case "delete":
+					s.results.Deleted++
+				}
+				return nil
+			})
+		}
+	}
+	limiter := flowcontrol.NewTokenBucketRateLimiter(float32(s.config.OperationRate), 1)
+	defer limiter.Stop()
+	return runRateLimited(ctx, limiter, ops)
+}
+
+// count returns the number of custom objects, using the remaining item count of a single item page so the API server
+// doesn't have to send them all.
+func (s *CustomObjectScale) count(ctx context.Context) (int, error) {
+	list, err := s.dynamicClient.Resource(customObjectResource).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+	count := len(list.Items)
+	if remaining := list.GetRemainingItemCount(); remaining != nil {
+		count += int(*remaining)
+	}
+	return count, nil
+}
+
+// scrapeStorageObjects records the etcd object counts once apiserver_storage_objects has caught up with the custom
+// objects, or as they are after customObjectStorageTimeout. It leaves them unset if the metrics couldn't be scraped.
+func (s *CustomObjectScale) scrapeStorageObjects(ctx context.Context) {
+	var counts map[string]int64
+	_ = wait.PollImmediate(10*time.Second, customObjectStorageTimeout, func() (bool, error) {
+		scraped, err := ScrapeAPIServerStorageObjects(ctx, s.clientSet)
+		if err != nil {
+			utils.Logf("failed to scrape etcd object counts of workload %q, retrying: %v", CustomObjectScaleWorkload, err)
+			return false, nil
+		}
+		counts = scraped
+		return counts[s.results.Resource] >= int64(s.results.Objects), nil
+	})
+	if counts == nil {
+		utils.Logf("not reporting etcd object counts of workload %q: the API server metrics couldn't be scraped", CustomObjectScaleWorkload)
+		return
+	}
+	objects, total := counts[s.results.Resource], int64(0)
+	for _, count := range counts {
+		total += count
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results.StorageObjects, s.results.TotalStorageObjects = &objects, &total
+	utils.Logf("etcd holds %d %s, %d objects in total", objects, s.results.Resource, total)
+}
+
+// summaryMeasurements returns the key measurements of the custom object scale workload for the run summary.
+func (r *CustomObjectScaleResults) summaryMeasurements() map[string]float64 {
+	m := map[string]float64{
+		"custom_object_time_to_target_count_seconds": r.TimeToTargetCount.Seconds(),
+	}
+	if r.StorageObjects != nil {
+		m["custom_object_storage_objects"] = float64(*r.StorageObjects)
+	}
+	for verb, latency := range r.Latency {
+		m["custom_object_"+verb+"_latency_p99_seconds"] = latency.Perc99.Seconds()
+	}
+	return m
+}
+
+// ExpectCustomObjectScaleSLOs fails the current spec if the latency of creating, updating or deleting custom objects
+// breaches slo.
+func ExpectCustomObjectScaleSLOs(results *CustomObjectScaleResults, slo CustomObjectScaleSLO) {
+	if slo.MaxLatencyP99 == 0 {
+		return
+	}
+	Expect(results).NotTo(BeNil(), "custom object scale results are required to check SLOs")
+	for verb, latency := range results.Latency {
+		utils.Logf("custom object %s latency is p99=%s, SLO maximum is %s", verb, latency.Perc99, slo.MaxLatencyP99)
+		Expect(latency.Perc99).To(BeNumerically("<=", slo.MaxLatencyP99), "p99 custom object %s latency is above SLO", verb)
+	}
+}
@@ -0,0 +1,99 @@
+package specs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newFakeAPIExtensions returns a fake apiextensions clientset holding objects, which establishes CRDs on creation.
+func newFakeAPIExtensions(objects ...runtime.Object) *apiextensionsfake.Clientset {
+	apiExtensions := apiextensionsfake.NewSimpleClientset(objects...)
+	// the fake clientset doesn't establish CRDs, so do what the API server would
+	apiExtensions.PrependReactor("create", "customresourcedefinitions", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		crd := action.(k8stesting.CreateAction).GetObject().(*apiextensionsv1.CustomResourceDefinition)
+		crd.Status.Conditions = []apiextensionsv1.CustomResourceDefinitionCondition{{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue}}
+		return false, nil, nil
+	})
+	return apiExtensions
+}
+
+func TestCustomObjectScale(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	clientSet := fake.NewSimpleClientset()
+	apiExtensions := newFakeAPIExtensions()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{customObjectResource: "ScaleObjectList"})
+
+	s := NewCustomObjectScale(clientSet, apiExtensions, dynamicClient, CustomObjectScaleConfig{
+		TestID:              "crd-scale",
+		Namespaces:          2,
+		ObjectsPerNamespace: 5,
+		ObjectSizeBytes:     100,
+		UpdatesPerObject:    2,
+		OperationRate:       1000,
+		TargetCountTimeout:  5 * time.Second,
+	})
+	g.Expect(s.Install(ctx)).To(Succeed())
+	g.Expect(s.Create(ctx)).To(Succeed())
+	g.Expect(s.count(ctx)).To(Equal(10))
+	g.Expect(s.Update(ctx)).To(Succeed())
+	object, err := dynamicClient.Resource(customObjectResource).Namespace("crd-scale-2").Get(ctx, "scaleobject-4", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(object.Object["spec"]).To(HaveKeyWithValue("revision", BeEquivalentTo(2)))
+	g.Expect(s.Delete(ctx)).To(Succeed())
+	g.Expect(s.count(ctx)).To(BeZero())
+
+	results := s.Results()
+	g.Expect(results.Resource).To(Equal("scaleobjects.knarly.azure.com"))
+	g.Expect(results.Objects).To(Equal(10))
+	g.Expect(results.Created).To(Equal(10))
+	g.Expect(results.Updated).To(Equal(20))
+	g.Expect(results.Deleted).To(Equal(10))
+	g.Expect(results.TimeToTargetCount).To(BeNumerically(">", 0))
+	g.Expect(results.Latency).To(HaveLen(3))
+
+	s.Uninstall()
+	crds, err := apiExtensions.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(crds.Items).To(BeEmpty())
+	namespaces, err := clientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(namespaces.Items).To(BeEmpty())
+}
+
+func TestCustomObjectScaleInstallReplacesLeftoverCRD(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	leftover := &apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: customObjectResource.GroupResource().String()}}
+	apiExtensions := newFakeAPIExtensions(leftover)
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{customObjectResource: "ScaleObjectList"})
+
+	s := NewCustomObjectScale(fake.NewSimpleClientset(), apiExtensions, dynamicClient, CustomObjectScaleConfig{TestID: "crd-scale", Namespaces: 1})
+	g.Expect(s.Install(ctx)).To(Succeed())
+	crd, err := apiExtensions.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, leftover.Name, metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(crd.Spec.Versions).To(HaveLen(1))
+}
+
+func TestCustomObjectScaleResultsSummaryMeasurements(t *testing.T) {
+	g := NewWithT(t)
+	results := &CustomObjectScaleResults{TimeToTargetCount: time.Minute}
+	g.Expect(results.summaryMeasurements()).NotTo(HaveKey("custom_object_storage_objects"))
+
+	objects := int64(5000)
+	results.StorageObjects = &objects
+	g.Expect(results.summaryMeasurements()).To(HaveKeyWithValue("custom_object_storage_objects", 5000.0))
+}
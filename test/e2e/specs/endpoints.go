@@ -0,0 +1,226 @@
+package specs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// EndpointPhaseReadyPropagation runs from a pod being observed Ready to its endpoint being observed ready in an
+	// EndpointSlice.
+	EndpointPhaseReadyPropagation = "ready_propagation"
+	// EndpointPhaseRemovalPropagation runs from a pod being observed terminating to its endpoint being observed not
+	// ready, or removed, in the EndpointSlices it was ready in.
+	EndpointPhaseRemovalPropagation = "removal_propagation"
+)
+
+type (
+	// EndpointResults are the EndpointSlice propagation latencies measured by an EndpointSliceTracker.
+	EndpointResults struct {
+		// Endpoints is the number of pods observed as a ready endpoint of a service
+		Endpoints int `json:"endpoints"`
+		// Phases maps each EndpointPhase, e.g. "ready_propagation", to its percentiles
+		Phases map[string]LatencyPercentiles `json:"phases"`
+	}
+
+	// EndpointSliceTracker watches pods and EndpointSlices in the test namespaces, i.e. the namespaces that did not
+	// exist yet when tracking started, and records how long pod readiness changes take to show in EndpointSlices.
+	EndpointSliceTracker struct {
+		clientSet kubernetes.Interface
+		factory   informers.SharedInformerFactory
+		start     time.Time
+
+		mu                 sync.Mutex
+		stopped            bool
+		existingNamespaces map[string]bool
+		pods               map[types.UID]*endpointRecord
+		// readyEndpoints maps the namespace/name of each EndpointSlice to the pods it has a ready endpoint for
+		readyEndpoints map[string]map[types.UID]bool
+	}
+
+	endpointRecord struct {
+		podReady        time.Time
+		endpointReady   time.Time
+		podTerminating  time.Time
+		endpointRemoved time.Time
+	}
+)
+
+// NewEndpointSliceTracker returns a tracker for the EndpointSlices of the cluster clientSet talks to, watching them
+// and pods with the informers of factory, see NewPodStartupTracker.
+func NewEndpointSliceTracker(clientSet kubernetes.Interface, factory informers.SharedInformerFactory) *EndpointSliceTracker {
+	return &EndpointSliceTracker{
+		clientSet:      clientSet,
+		factory:        factory,
+		pods:           map[types.UID]*endpointRecord{},
+		readyEndpoints: map[string]map[types.UID]bool{},
+	}
+}
+
+// Start records the existing namespaces and starts watching, until Stop is called or ctx is done.
+func (t *EndpointSliceTracker) Start(ctx context.Context) error {
+	t.start = time.Now()
+	existingNamespaces, err := listNamespaceNames(ctx, t.clientSet)
+	if err != nil {
+		return err
+	}
+	t.existingNamespaces = existingNamespaces
+
+	var synced []cache.InformerSynced
+	for _, informer := range []cache.SharedIndexInformer{
+		t.factory.Core().V1().Pods().Informer(),
+		t.factory.Discovery().V1().EndpointSlices().Informer(),
+	} {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { t.observeObject(obj, false, time.Now()) },
+			UpdateFunc: func(_, obj interface{}) { t.observeObject(obj, false, time.Now()) },
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				t.observeObject(obj, true, time.Now())
+			},
+		})
+		synced = append(synced, informer.HasSynced)
+	}
+	t.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return errors.New("timed out waiting for the EndpointSlice informers to sync")
+	}
+	return nil
+}
+
+// Stop stops recording and returns the propagation latencies observed since Start.
+func (t *EndpointSliceTracker) Stop() *EndpointResults {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+
+	phases := map[string][]time.Duration{}
+	// the pod and EndpointSlice watches race each other, so an endpoint seen before its pod counts as no delay
+	add := func(phase string, from, to time.Time) {
+		if from.IsZero() || to.IsZero() {
+			return
+		}
+		delay := to.Sub(from)
+		if delay < 0 {
+			delay = 0
+		}
+		phases[phase] = append(phases[phase], delay)
+	}
+	results := &EndpointResults{Phases: map[string]LatencyPercentiles{}}
+	for _, r := range t.pods {
+		if r.endpointReady.IsZero() {
+			continue
+		}
+		results.Endpoints++
+		add(EndpointPhaseReadyPropagation, r.podReady, r.endpointReady)
+		add(EndpointPhaseRemovalPropagation, r.podTerminating, r.endpointRemoved)
+	}
+	for phase, durations := range phases {
+		results.Phases[phase] = latencyPercentiles(durations)
+	}
+	return results
+}
+
+func (t *EndpointSliceTracker) observeObject(obj interface{}, deleted bool, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		t.observePod(o, deleted, now)
+	case *discoveryv1.EndpointSlice:
+		t.observeSlice(o, deleted, now)
+	}
+}
+
+func (t *EndpointSliceTracker) record(uid types.UID) *endpointRecord {
+	r, ok := t.pods[uid]
+	if !ok {
+		r = &endpointRecord{}
+		t.pods[uid] = r
+	}
+	return r
+}
+
+func (t *EndpointSliceTracker) observePod(pod *corev1.Pod, deleted bool, now time.Time) {
+	if t.existingNamespaces[pod.Namespace] {
+		return
+	}
+	r := t.record(pod.UID)
+	terminating := deleted || pod.DeletionTimestamp != nil
+	if r.podReady.IsZero() && !terminating {
+		if c := podCondition(pod, corev1.PodReady); c != nil && c.Status == corev1.ConditionTrue {
+			r.podReady = now
+		}
+	}
+	if r.podTerminating.IsZero() && terminating {
+		r.podTerminating = now
+	}
+}
+
+// observeSlice compares the pods slice has a ready endpoint for with the ones it had before, to spot endpoints that
+// became ready and ones that stopped being ready or were removed.
+func (t *EndpointSliceTracker) observeSlice(slice *discoveryv1.EndpointSlice, deleted bool, now time.Time) {
+	if t.existingNamespaces[slice.Namespace] {
+		return
+	}
+	key := slice.Namespace + "/" + slice.Name
+	ready := map[types.UID]bool{}
+	if !deleted {
+		for _, e := range slice.Endpoints {
+			// a nil ready condition means ready, see the EndpointConditions docs
+			if e.TargetRef != nil && e.TargetRef.Kind == "Pod" && (e.Conditions.Ready == nil || *e.Conditions.Ready) {
+				ready[e.TargetRef.UID] = true
+			}
+		}
+	}
+	for uid := range ready {
+		if r := t.record(uid); r.endpointReady.IsZero() && !t.readyEndpoints[key][uid] {
+			r.endpointReady = now
+		}
+	}
+	for uid := range t.readyEndpoints[key] {
+		if r := t.record(uid); !ready[uid] && r.endpointRemoved.IsZero() {
+			r.endpointRemoved = now
+		}
+	}
+	if deleted {
+		delete(t.readyEndpoints, key)
+		return
+	}
+	t.readyEndpoints[key] = ready
+}
+
+// ExpectEndpointSLOs fails the current spec if the EndpointSlice propagation latency measured by the specs package
+// breaches slo.
+func ExpectEndpointSLOs(results *EndpointResults, slo ServiceChurnSLO) {
+	if slo.MaxEndpointPropagationLatencyP99 == 0 {
+		return
+	}
+	Expect(results).NotTo(BeNil(), "endpoint results are required to check SLOs")
+	Expect(results.Phases).To(HaveKey(EndpointPhaseReadyPropagation), "no pod was observed becoming a ready endpoint")
+	latency := results.Phases[EndpointPhaseReadyPropagation]
+	utils.Logf("endpoint ready propagation latency is p99=%s, SLO maximum is %s", latency.Perc99, slo.MaxEndpointPropagationLatencyP99)
+	Expect(latency.Perc99).To(BeNumerically("<=", slo.MaxEndpointPropagationLatencyP99), "p99 endpoint ready propagation latency is above SLO")
+}
+
+// expectSLOs checks the measured pod startup latency and the endpoint results against the SLOs of the config.
+func (c ServiceChurnTestConfig) expectSLOs(results *WorkloadResults) {
+	ExpectPodStartupSLOs(results.PodStartup, c.PodStartupSLO)
+	ExpectEndpointSLOs(results.Endpoints, c.SLO)
+}
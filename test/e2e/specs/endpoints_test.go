@@ -0,0 +1,73 @@
+package specs
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+)
+
+func TestEndpointSliceTracker(t *testing.T) {
+	g := NewWithT(t)
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	clientSet := fake.NewSimpleClientset()
+	tracker := NewEndpointSliceTracker(clientSet, informers.NewSharedInformerFactory(clientSet, 0))
+	tracker.existingNamespaces = map[string]bool{"kube-system": true}
+	at := func(millis int) time.Time { return start.Add(time.Duration(millis) * time.Millisecond) }
+
+	pod := func(uid string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test-1", Name: uid, UID: types.UID(uid)},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+		}
+	}
+	slice := func(endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{Namespace: "test-1", Name: "service-0-abcde"}, Endpoints: endpoints}
+	}
+	endpoint := func(uid string, ready *bool) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", UID: types.UID(uid)},
+			Conditions: discoveryv1.EndpointConditions{Ready: ready},
+		}
+	}
+
+	// old becomes ready and shows in the slice 100ms later, new shows in the slice before its pod is seen ready
+	tracker.observeObject(pod("old"), false, at(0))
+	tracker.observeObject(slice(endpoint("old", nil)), false, at(100))
+	tracker.observeObject(slice(endpoint("old", nil), endpoint("new", pointer.Bool(true))), false, at(200))
+	tracker.observeObject(pod("new"), false, at(250))
+
+	// old starts terminating and is marked not ready 300ms later, then the slice goes away along with new
+	terminating := pod("old")
+	terminating.DeletionTimestamp = &metav1.Time{Time: at(1000)}
+	tracker.observeObject(terminating, false, at(1000))
+	tracker.observeObject(slice(endpoint("old", pointer.Bool(false)), endpoint("new", nil)), false, at(1300))
+	tracker.observeObject(pod("new"), true, at(2000))
+	tracker.observeObject(slice(endpoint("new", nil)), true, at(2500))
+
+	// pods that are never ready endpoints don't count
+	tracker.observeObject(pod("lonely"), false, at(0))
+	kubeSystem := pod("dns")
+	kubeSystem.Namespace = "kube-system"
+	tracker.observeObject(kubeSystem, false, at(0))
+
+	results := tracker.Stop()
+	g.Expect(results.Endpoints).To(Equal(2))
+	g.Expect(results.Phases[EndpointPhaseReadyPropagation]).To(Equal(LatencyPercentiles{
+		Perc50: 0,
+		Perc90: 100 * time.Millisecond,
+		Perc99: 100 * time.Millisecond,
+	}))
+	g.Expect(results.Phases[EndpointPhaseRemovalPropagation]).To(Equal(LatencyPercentiles{
+		Perc50: 300 * time.Millisecond,
+		Perc90: 500 * time.Millisecond,
+		Perc99: 500 * time.Millisecond,
+	}))
+}
@@ -0,0 +1,324 @@
+package specs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/cluster-api/test/framework/clusterctl"
+)
+
+// topWarningReasons is how many warning reasons an event summary lists.
+const topWarningReasons = 10
+
+type (
+	// EventFilter selects the events an EventRecorder records. Empty fields select all events.
+	EventFilter struct {
+		// Namespaces are the namespaces to record the events of
+		Namespaces []string
+		// Reasons are the reasons to record the events of, e.g. "FailedScheduling"
+		Reasons []string
+	}
+
+	// RecordedEvent is one line of the NDJSON an EventRecorder writes, an event as it was when the recorder saw it
+	// being created or updated.
+	RecordedEvent struct {
+		// Observed is when the recorder saw the event
+		Observed  time.Time `json:"observed"`
+		Namespace string    `json:"namespace"`
+		// Kind and Name are of the object the event is about, e.g. "Pod" and "deployment-churn-0-5d8c7-x2x9z"
+		Kind    string `json:"kind"`
+		Name    string `json:"name"`
+		Type    string `json:"type"`
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+		// Count is how often the event happened so far, as events are updated rather than repeated
+		Count          int32     `json:"count"`
+		FirstTimestamp time.Time `json:"firstTimestamp,omitempty"`
+		LastTimestamp  time.Time `json:"lastTimestamp,omitempty"`
+		// Source is the component that reported the event, e.g. "default-scheduler"
+		Source string `json:"source,omitempty"`
+	}
+
+	// EventReasonCount is how often events of a reason happened while recording.
+	EventReasonCount struct {
+		Reason string `json:"reason"`
+		// Count is the number of occurrences, which counts each repetition of an updated event
+		Count int `json:"count"`
+		// Objects is the number of distinct objects the events are about
+		Objects int `json:"objects"`
+		// Message is the message of the latest event of the reason
+		Message string `json:"message"`
+	}
+
+	// EventSummary summarizes the events an EventRecorder recorded.
+	EventSummary struct {
+		// Recorded is the number of lines written to the NDJSON
+		Recorded int `json:"recorded"`
+		// Normal and Warning are the number of occurrences of events of each type
+		Normal  int `json:"normal"`
+		Warning int `json:"warning"`
+		// TopWarningReasons are the warning reasons that occurred most, e.g. FailedScheduling, FailedMount and BackOff
+		TopWarningReasons []EventReasonCount `json:"topWarningReasons"`
+	}
+
+	// EventRecorder watches the events of a cluster with a shared informer and streams those created or updated while
+	// recording, and selected by its filter, to NDJSON.
+	EventRecorder struct {
+		factory informers.SharedInformerFactory
+		filter  EventFilter
+		path    string
+		start   time.Time
+
+		mu       sync.Mutex
+		file     *os.File
+		out      *bufio.Writer
+		writeErr error
+		// counts are the last seen count of each event, to count the occurrences since the last update
+		counts   map[types.UID]int32
+		summary  EventSummary
+		warnings map[string]*eventReasonRecord
+	}
+
+	eventReasonRecord struct {
+		count   int
+		objects map[types.UID]bool
+		message string
+	}
+)
+
+// ResolveEventFilter reads the events to record from the KNARLY_EVENT_NAMESPACES and KNARLY_EVENT_REASONS variables,
+// comma separated lists that select all events when not set.
+func ResolveEventFilter(e2eConfig *clusterctl.E2EConfig) EventFilter {
+	return EventFilter{
+		Namespaces: splitList(optionalVariable(e2eConfig, utils.EventNamespaces)),
+		Reasons:    splitList(optionalVariable(e2eConfig, utils.EventReasons)),
+	}
+}
+
+// NewEventRecorder returns a recorder of the events watched by the event informer of factory, writing to path. The
+// informers of factory run until the context passed to Start is done, see NewPodStartupTracker.
+func NewEventRecorder(factory informers.SharedInformerFactory, filter EventFilter, path string) *EventRecorder {
+	return &EventRecorder{
+		factory:  factory,
+		filter:   filter,
+		path:     path,
+		counts:   map[types.UID]int32{},
+		warnings: map[string]*eventReasonRecord{},
+	}
+}
+
+// Start creates the NDJSON file and starts watching events, until Stop is called or ctx is done. Events that last
+// happened before Start are not recorded, unless they happen again.
+func (r *EventRecorder) Start(ctx context.Context) error {
+	r.start = time.Now()
+	file, err := os.Create(r.path)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", r.path)
+	}
+	r.file, r.out = file, bufio.NewWriter(file)
+
+	informer := r.factory.Core().V1().Events().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if event, ok := obj.(*corev1.Event); ok {
+				r.observe(event, time.Now())
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if event, ok := obj.(*corev1.Event); ok {
+				r.observe(event, time.Now())
+			}
+		},
+	})
+	r.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.file.Close()
+		r.file = nil
+		return errors.New("timed out waiting for the event informer to sync")
+	}
+	return nil
+}
+
+// Stop stops recording events, closes the NDJSON file and returns the summary of the events recorded since Start.
+func (r *EventRecorder) Stop() (*EventSummary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		if err := r.out.Flush(); err != nil && r.writeErr == nil {
+			r.writeErr = errors.Wrapf(err, "writing %s", r.path)
+		}
+		if err := r.file.Close(); err != nil && r.writeErr == nil {
+			r.writeErr = errors.Wrapf(err, "closing %s", r.path)
+		}
+		r.file = nil
+	}
+
+	summary := r.summary
+	summary.TopWarningReasons = []EventReasonCount{}
+	for reason, record := range r.warnings {
+		summary.TopWarningReasons = append(summary.TopWarningReasons, EventReasonCount{Reason: reason, Count: record.count, Objects: len(record.objects), Message: record.message})
+	}
+	sort.Slice(summary.TopWarningReasons, func(i, j int) bool {
+		a, b := summary.TopWarningReasons[i], summary.TopWarningReasons[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Reason < b.Reason
+	})
+	if len(summary.TopWarningReasons) > topWarningReasons {
+		summary.TopWarningReasons = summary.TopWarningReasons[:topWarningReasons]
+	}
+	return &summary, r.writeErr
+}
+
+// observe writes the event if it is selected and happened since the last time it was seen, and counts its new
+// occurrences.
+func (r *EventRecorder) observe(event *corev1.Event, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := event.Count
+	if count < 1 {
+		count = 1
+	}
+	if event.Series != nil && event.Series.Count > count {
+		count = event.Series.Count
+	}
+	previous, seen := r.counts[event.UID]
+	r.counts[event.UID] = count
+	if !r.selects(event) || r.file == nil {
+		return
+	}
+	if !seen && eventLastHappened(event).Before(r.start.Truncate(time.Second)) {
+		// the informer lists the events that happened before recording started
+		return
+	}
+	// updates that are not repetitions, e.g. of the message only, don't add occurrences
+	occurrences := int(count - previous)
+	if occurrences < 0 {
+		occurrences = 0
+	}
+
+	line, err := json.Marshal(RecordedEvent{
+		Observed:       now,
+		Namespace:      event.Namespace,
+		Kind:           event.InvolvedObject.Kind,
+		Name:           event.InvolvedObject.Name,
+		Type:           event.Type,
+		Reason:         event.Reason,
+		Message:        event.Message,
+		Count:          count,
+		FirstTimestamp: event.FirstTimestamp.Time,
+		LastTimestamp:  eventLastHappened(event),
+		Source:         eventSource(event),
+	})
+	if err == nil {
+		_, err = r.out.Write(append(line, '\n'))
+	}
+	if err != nil && r.writeErr == nil {
+		r.writeErr = errors.Wrapf(err, "writing %s", r.path)
+	}
+	r.summary.Recorded++
+
+	if event.Type != corev1.EventTypeWarning {
+		r.summary.Normal += occurrences
+		return
+	}
+	r.summary.Warning += occurrences
+	record := r.warnings[event.Reason]
+	if record == nil {
+		record = &eventReasonRecord{objects: map[types.UID]bool{}}
+		r.warnings[event.Reason] = record
+	}
+	record.count += occurrences
+	record.objects[event.InvolvedObject.UID] = true
+	record.message = event.Message
+}
+
+func (r *EventRecorder) selects(event *corev1.Event) bool {
+	return (len(r.filter.Namespaces) == 0 || contains(r.filter.Namespaces, event.Namespace)) &&
+		(len(r.filter.Reasons) == 0 || contains(r.filter.Reasons, event.Reason))
+}
+
+// recordWorkloadEvents records the events of the input cluster selected by input.Events, as watched by the event
+// informer of factory, to events.ndjson among the measurements of the workload run runID, and returns a func that
+// stops recording and writes and logs the summary. Events are nice to have, so failing to record them is logged
+// rather than failing the workload.
+func recordWorkloadEvents(ctx context.Context, factory informers.SharedInformerFactory, input ClusterTestInput, runID string) func() {
+	measurementsDir := workloadMeasurementsDir(input, runID)
+	recorder := NewEventRecorder(factory, input.Events, filepath.Join(measurementsDir, "events.ndjson"))
+	if err := recorder.Start(ctx); err != nil {
+		utils.Logf("not recording the events of workload run %q: %v", runID, err)
+		return func() {}
+	}
+	return func() {
+		summary, err := recorder.Stop()
+		if err != nil {
+			utils.Logf("failed to record the events of workload run %q: %v", runID, err)
+		}
+		if err := writeJSON(filepath.Join(measurementsDir, "event-summary.json"), summary); err != nil {
+			utils.Logf("failed to write the event summary of workload run %q: %v", runID, err)
+		}
+		utils.Logf("workload run %q caused %d normal and %d warning events", runID, summary.Normal, summary.Warning)
+		for _, reason := range summary.TopWarningReasons {
+			utils.Logf("  %dx %s on %d objects, latest: %s", reason.Count, reason.Reason, reason.Objects, reason.Message)
+		}
+	}
+}
+
+// eventLastHappened returns when the event last happened, whichever API version reported it.
+func eventLastHappened(event *corev1.Event) time.Time {
+	last := event.LastTimestamp.Time
+	if event.Series != nil && event.Series.LastObservedTime.Time.After(last) {
+		last = event.Series.LastObservedTime.Time
+	}
+	if event.EventTime.Time.After(last) {
+		last = event.EventTime.Time
+	}
+	if last.IsZero() {
+		last = event.CreationTimestamp.Time
+	}
+	return last
+}
+
+func eventSource(event *corev1.Event) string {
+	if event.ReportingController != "" {
+		return event.ReportingController
+	}
+	return event.Source.Component
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package specs
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEventRecorderObserve(t *testing.T) {
+	g := NewWithT(t)
+	start := time.Now().Truncate(time.Second)
+	event := func(uid, namespace, reason, eventType string, count int32, last time.Duration) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: namespace, Name: uid, UID: types.UID(uid)},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "pod-" + uid, UID: types.UID("pod-" + uid)},
+			Type:           eventType,
+			Reason:         reason,
+			Message:        reason + " " + uid,
+			Count:          count,
+			LastTimestamp:  metav1.NewTime(start.Add(last)),
+			Source:         corev1.EventSource{Component: "default-scheduler"},
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	r := NewEventRecorder(informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0), EventFilter{Namespaces: []string{"churn-0"}}, path)
+	file, err := os.Create(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	r.start, r.file, r.out = start, file, bufio.NewWriter(file)
+
+	// listed by the informer, but happened before recording started
+	old := event("a", "churn-0", "BackOff", corev1.EventTypeWarning, 3, -time.Minute)
+	r.observe(old, start)
+	r.observe(event("b", "churn-0", "Scheduled", corev1.EventTypeNormal, 1, time.Second), start.Add(time.Second))
+	r.observe(event("c", "kube-system", "FailedScheduling", corev1.EventTypeWarning, 1, time.Second), start.Add(time.Second))
+	r.observe(event("d", "churn-0", "FailedScheduling", corev1.EventTypeWarning, 1, 2*time.Second), start.Add(2*time.Second))
+	r.observe(event("e", "churn-0", "FailedScheduling", corev1.EventTypeWarning, 1, 2*time.Second), start.Add(2*time.Second))
+	// the old event happens twice more, which counts only the new occurrences
+	old.Count, old.LastTimestamp = 5, metav1.NewTime(start.Add(3*time.Second))
+	r.observe(old, start.Add(3*time.Second))
+
+	summary, err := r.Stop()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(summary.Recorded).To(Equal(4))
+	g.Expect(summary.Normal).To(Equal(1))
+	g.Expect(summary.Warning).To(Equal(4))
+	g.Expect(summary.TopWarningReasons).To(Equal([]EventReasonCount{
+		{Reason: "BackOff", Count: 2, Objects: 1, Message: "BackOff a"},
+		{Reason: "FailedScheduling", Count: 2, Objects: 2, Message: "FailedScheduling e"},
+	}))
+
+	file, err = os.Open(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer file.Close()
+	var recorded []RecordedEvent
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var e RecordedEvent
+		g.Expect(json.Unmarshal(scanner.Bytes(), &e)).To(Succeed())
+		recorded = append(recorded, e)
+	}
+	g.Expect(recorded).To(HaveLen(4))
+	g.Expect(recorded[0].Reason).To(Equal("Scheduled"))
+	g.Expect(recorded[0].Source).To(Equal("default-scheduler"))
+	g.Expect(recorded[3].Name).To(Equal("pod-a"))
+	g.Expect(recorded[3].Count).To(Equal(int32(5)))
+}
+
+func TestResolveEventFilter(t *testing.T) {
+	g := NewWithT(t)
+
+	t.Setenv(utils.EventNamespaces, "")
+	t.Setenv(utils.EventReasons, "FailedScheduling, FailedMount,,BackOff")
+	g.Expect(ResolveEventFilter(nil)).To(Equal(EventFilter{Reasons: []string{"FailedScheduling", "FailedMount", "BackOff"}}))
+}
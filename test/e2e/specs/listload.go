@@ -0,0 +1,336 @@
+package specs
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	// ListLoadWorkload names the measurements of the LIST load, which runs alongside other workloads.
+	ListLoadWorkload = "list-load"
+
+	// ListModeFull LISTs a resource across the cluster in one request.
+	ListModeFull = "full"
+	// ListModePaginated LISTs a resource across the cluster in pages of PageSize objects.
+	ListModePaginated = "paginated"
+)
+
+// listLoadResources are the core resources the LIST load supports.
+var listLoadResources = []string{"pods", "events", "configmaps", "secrets", "services", "endpoints"}
+
+type (
+	// ListLoadConfig configures a ListLoad.
+	ListLoadConfig struct {
+		// Resources are the core resources to LIST across the cluster, e.g. "pods" and "events", round robin
+		Resources []string
+		// FullListCallers is the number of concurrent callers making full LISTs
+		FullListCallers int
+		// PaginatedListCallers is the number of concurrent callers making paginated LISTs
+		PaginatedListCallers int
+		// ListsPerSecond is the target rate of LISTs of each caller, where a paginated LIST counts once for all its pages
+		ListsPerSecond float64
+		// PageSize is the number of objects per page of paginated LISTs
+		PageSize int64
+		// RequestTimeout bounds each request, requests taking longer count as timeouts
+		RequestTimeout time.Duration
+		// SLO declares the thresholds the results must meet for the spec to pass
+		SLO ListLoadSLO
+	}
+
+	// ListLoadSLO declares the thresholds the results of a ListLoad must meet, zero values are not checked.
+	ListLoadSLO struct {
+		// MaxLatencyP99 is the maximum 99th percentile latency of the LIST requests of each mode and resource
+		MaxLatencyP99 time.Duration
+	}
+
+	// ListLoadStats are the measurements of the LIST requests of one mode and resource.
+	ListLoadStats struct {
+		// Requests is the number of requests made, counting each page of paginated LISTs
+		Requests int `json:"requests"`
+		// Lists is the number of LISTs that completed, i.e. got all their pages
+		Lists int `json:"lists"`
+		// TooManyRequests is the number of requests the API server throttled with a 429
+		TooManyRequests int `json:"tooManyRequests"`
+		// Timeouts is the number of requests that timed out, either client or server side
+		Timeouts int `json:"timeouts"`
+		// Errors is the number of requests that failed otherwise
+		Errors int `json:"errors"`
+		// Latency holds the percentiles of the response latency of the successful requests
+		Latency LatencyPercentiles `json:"latency"`
+		// AvgResponseBytes and MaxResponseBytes are the size of the successful responses
+		AvgResponseBytes int64 `json:"avgResponseBytes"`
+		MaxResponseBytes int64 `json:"maxResponseBytes"`
+	}
+
+	// ListLoadResults are the measurements of a ListLoad.
+	ListLoadResults struct {
+		// Stats maps "<mode>/<resource>", e.g. "paginated/pods", to the measurements of its requests
+		Stats map[string]*ListLoadStats `json:"stats"`
+		// Duration is how long the LIST load ran for
+		Duration time.Duration `json:"duration"`
+	}
+
+	// ListLoad makes concurrent full and paginated LISTs across the cluster at a target rate, until stopped.
+	ListLoad struct {
+		clientSet kubernetes.Interface
+		config    ListLoadConfig
+		start     time.Time
+		cancel    context.CancelFunc
+		callers   sync.WaitGroup
+		stopOnce  sync.Once
+		duration  time.Duration
+
+		mu       sync.Mutex
+		requests map[string]*listLoadRequests
+	}
+
+	listLoadRequests struct {
+		stats     ListLoadStats
+		latencies []time.Duration
+		bytes     int64
+	}
+)
+
+// Validate checks the config for values a ListLoad can't run with.
+func (c ListLoadConfig) Validate() error {
+	var errs field.ErrorList
+	if len(c.Resources) == 0 {
+		errs = append(errs, field.Required(field.NewPath("Resources"), "at least one resource to LIST is required"))
+	}
+	for i, resource := range c.Resources {
+		errs = append(errs, validateOneOf(field.NewPath("Resources").Index(i), resource, listLoadResources)...)
+	}
+	if c.FullListCallers < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("FullListCallers"), c.FullListCallers, "must not be negative"))
+	}
+	if c.PaginatedListCallers < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("PaginatedListCallers"), c.PaginatedListCallers, "must not be negative"))
+	}
+	if c.FullListCallers+c.PaginatedListCallers <= 0 {
+		errs = append(errs, field.Required(field.NewPath("FullListCallers"), "at least one full or paginated LIST caller is required"))
+	}
+	if c.ListsPerSecond <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("ListsPerSecond"), c.ListsPerSecond, "must be greater than zero"))
+	}
+	if c.PaginatedListCallers > 0 && c.PageSize <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("PageSize"), c.PageSize, "must be greater than zero for paginated LISTs"))
+	}
+	if c.RequestTimeout <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("RequestTimeout"), c.RequestTimeout, "must be greater than zero"))
+	}
+	return errs.ToAggregate()
+}
+
+// RunWithListLoad runs the LIST load against the input cluster for as long as run runs, e.g. a call to
+// RunPodChurnTest, writes its results to list-load.json among the measurements of the cluster, and fails the spec if
+// they breach the SLO.
+func RunWithListLoad(ctx context.Context, input ClusterTestInput, config ListLoadConfig, run func()) *ListLoadResults {
+	specName := "run-list-load-tests"
+	Expect(input.BootstrapClusterProxy).NotTo(BeNil(), "Invalid argument. input.BootstrapClusterProxy can't be nil when calling %s spec", specName)
+	Expect(input.Cluster).NotTo(BeNil(), "Invalid argument. input.Cluster can't be nil when calling %s spec", specName)
+	Expect(input.ArtifactFolder).NotTo(BeEmpty(), "Invalid argument. input.ArtifactFolder can't be empty when calling %s spec", specName)
+	Expect(run).NotTo(BeNil(), "Invalid argument. run can't be nil when calling %s spec", specName)
+	Expect(config.Validate()).To(Succeed(), "Invalid parameters for workload %q", ListLoadWorkload)
+
+	clusterProxy := input.BootstrapClusterProxy.GetWorkloadCluster(ctx, input.Cluster.Namespace, input.Cluster.Name)
+	// the API server, not the client, is what should throttle the LISTs
+	restConfig := rest.CopyConfig(clusterProxy.GetRESTConfig())
+	restConfig.RateLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	Expect(err).ToNot(HaveOccurred())
+
+	runID := workloadRunID(input, ListLoadWorkload)
+	summary := input.Summary.startWorkload(input.Cluster.Name, runID, ListLoadWorkload, config)
+	passed := false
+	defer func() { summary.finish(passed) }()
+	load := NewListLoad(clientSet, config)
+	load.Start(ctx)
+	// stop the callers also when run fails the spec
+	defer load.Stop()
+	run()
+	results := load.Stop()
+	summary.measured(results.summaryMeasurements())
+
+	measurementsDir := workloadMeasurementsDir(input, runID)
+	Expect(writeJSON(filepath.Join(measurementsDir, "list-load.json"), results)).To(Succeed())
+	ExpectListLoadSLOs(results, config.SLO)
+	passed = true
+	return results
+}
+
+// NewListLoad returns a LIST load on the cluster clientSet talks to. Requests are not retried, so clientSet should not
+// be rate limited client side for the API server throttling to show.
+func NewListLoad(clientSet kubernetes.Interface, config ListLoadConfig) *ListLoad {
+	return &ListLoad{
+		clientSet: clientSet,
+		config:    config,
+		requests:  map[string]*listLoadRequests{},
+	}
+}
+
+// Start starts the callers, which run until Stop is called or ctx is done.
+func (l *ListLoad) Start(ctx context.Context) {
+	l.start = time.Now()
+	ctx, l.cancel = context.WithCancel(ctx)
+	utils.Logf("starting %d full and %d paginated LIST callers of %v at %g/s each", l.config.FullListCallers, l.config.PaginatedListCallers, l.config.Resources, l.config.ListsPerSecond)
+	for i := 0; i < l.config.FullListCallers+l.config.PaginatedListCallers; i++ {
+		mode := ListModeFull
+		if i >= l.config.FullListCallers {
+			mode = ListModePaginated
+		}
+		l.callers.Add(1)
+		go func(mode string, caller int) {
+			defer l.callers.Done()
+			l.call(ctx, mode, caller)
+		}(mode, i)
+	}
+}
+
+// Stop stops the callers and returns the measurements of their requests. It can be called more than once.
+func (l *ListLoad) Stop() *ListLoadResults {
+	l.stopOnce.Do(func() {
+		if l.cancel != nil {
+			l.cancel()
+		}
+		l.callers.Wait()
+		l.duration = time.Since(l.start)
+	})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	results := &ListLoadResults{Stats: map[string]*ListLoadStats{}, Duration: l.duration}
+	var keys []string
+	for key, r := range l.requests {
+		stats := r.stats
+		stats.Latency = latencyPercentiles(r.latencies)
+		if len(r.latencies) > 0 {
+			stats.AvgResponseBytes = r.bytes / int64(len(r.latencies))
+		}
+		results.Stats[key] = &stats
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := results.Stats[key]
+		utils.Logf("%s LISTs: %d requests, %d lists, %d throttled, %d timed out, %d failed, latency p50=%s p99=%s, max response %d bytes",
+			key, s.Requests, s.Lists, s.TooManyRequests, s.Timeouts, s.Errors, s.Latency.Perc50, s.Latency.Perc99, s.MaxResponseBytes)
+	}
+	return results
+}
+
+// call makes LISTs of the resources round robin at ListsPerSecond, starting from a different resource for each caller.
+func (l *ListLoad) call(ctx context.Context, mode string, caller int) {
+	limiter := flowcontrol.NewTokenBucketRateLimiter(float32(l.config.ListsPerSecond), 1)
+	defer limiter.Stop()
+	for i := caller; ; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return
+		}
+		l.list(ctx, mode, l.config.Resources[i%len(l.config.Resources)])
+	}
+}
+
+// list LISTs resource across the cluster, following the continue tokens of paginated LISTs until the last page or
+// the first failure.
+func (l *ListLoad) list(ctx context.Context, mode, resource string) {
+	opts := metav1.ListOptions{}
+	if mode == ListModePaginated {
+		opts.Limit = l.config.PageSize
+	}
+	for {
+		requestCtx, cancel := context.WithTimeout(ctx, l.config.RequestTimeout)
+		start := time.Now()
+		body, err := l.clientSet.CoreV1().RESTClient().Get().
+			Resource(resource).
+			VersionedParams(&opts, scheme.ParameterCodec).
+			MaxRetries(0).
+			DoRaw(requestCtx)
+		latency := time.Since(start)
+		cancel()
+		if ctx.Err() != nil {
+			// stopping, which is not the fault of the API server
+			return
+		}
+		var continueToken string
+		if err == nil {
+			var list struct {
+				Metadata metav1.ListMeta `json:"metadata"`
+			}
+			if err = json.Unmarshal(body, &list); err == nil {
+				continueToken = list.Metadata.Continue
+			}
+		}
+		l.record(mode+"/"+resource, latency, len(body), err, err == nil && continueToken == "")
+		if err != nil || continueToken == "" {
+			return
+		}
+		opts.Continue = continueToken
+	}
+}
+
+func (l *ListLoad) record(key string, latency time.Duration, size int, err error, complete bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.requests[key]
+	if !ok {
+		r = &listLoadRequests{}
+		l.requests[key] = r
+	}
+	r.stats.Requests++
+	switch {
+	case err == nil:
+		r.latencies = append(r.latencies, latency)
+		r.bytes += int64(size)
+		if int64(size) > r.stats.MaxResponseBytes {
+			r.stats.MaxResponseBytes = int64(size)
+		}
+		if complete {
+			r.stats.Lists++
+		}
+	case apierrors.IsTooManyRequests(err):
+		r.stats.TooManyRequests++
+	case errors.Is(err, context.DeadlineExceeded) || apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err):
+		r.stats.Timeouts++
+	default:
+		r.stats.Errors++
+	}
+}
+
+// summaryMeasurements returns the key measurements of the LIST load for the run summary.
+func (r *ListLoadResults) summaryMeasurements() map[string]float64 {
+	m := map[string]float64{}
+	for key, stats := range r.Stats {
+		prefix := "list_" + strings.ReplaceAll(key, "/", "_")
+		m[prefix+"_latency_p99_seconds"] = stats.Latency.Perc99.Seconds()
+		m[prefix+"_too_many_requests"] = float64(stats.TooManyRequests)
+		m[prefix+"_timeouts"] = float64(stats.Timeouts)
+	}
+	return m
+}
+
+// ExpectListLoadSLOs fails the current spec if the latency of the LISTs of any mode and resource breaches slo.
+func ExpectListLoadSLOs(results *ListLoadResults, slo ListLoadSLO) {
+	if slo.MaxLatencyP99 == 0 {
+		return
+	}
+	Expect(results).NotTo(BeNil(), "LIST load results are required to check SLOs")
+	for key, stats := range results.Stats {
+		utils.Logf("%s LIST latency is p99=%s, SLO maximum is %s", key, stats.Latency.Perc99, slo.MaxLatencyP99)
+		Expect(stats.Latency.Perc99).To(BeNumerically("<=", slo.MaxLatencyP99), "p99 %s LIST latency is above SLO", key)
+	}
+}
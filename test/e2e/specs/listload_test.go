@@ -0,0 +1,71 @@
+package specs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestListLoad(t *testing.T) {
+	g := NewWithT(t)
+	// pods come in 3 pages when paginated, events are always throttled
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/pods":
+			next := ""
+			switch r.URL.Query().Get("continue") {
+			case "":
+				if r.URL.Query().Get("limit") != "" {
+					next = "page-2"
+				}
+			case "page-2":
+				next = "page-3"
+			}
+			fmt.Fprintf(w, `{"kind":"PodList","apiVersion":"v1","metadata":{"continue":%q},"items":[]}`, next)
+		case "/api/v1/events":
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	clientSet, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL, RateLimiter: flowcontrol.NewFakeAlwaysRateLimiter()})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	config := ListLoadConfig{
+		Resources:            []string{"pods", "events"},
+		FullListCallers:      1,
+		PaginatedListCallers: 1,
+		ListsPerSecond:       20,
+		PageSize:             10,
+		RequestTimeout:       time.Second,
+	}
+	g.Expect(config.Validate()).To(Succeed())
+	load := NewListLoad(clientSet, config)
+	load.Start(context.Background())
+	time.Sleep(500 * time.Millisecond)
+	results := load.Stop()
+	g.Expect(load.Stop()).To(Equal(results))
+
+	g.Expect(results.Stats).To(HaveLen(4))
+	full := results.Stats["full/pods"]
+	g.Expect(full.Lists).To(BeNumerically(">", 0))
+	g.Expect(full.Requests).To(Equal(full.Lists))
+	g.Expect(full.MaxResponseBytes).To(BeNumerically(">", 0))
+	paginated := results.Stats["paginated/pods"]
+	g.Expect(paginated.Lists).To(BeNumerically(">", 0))
+	g.Expect(paginated.Requests).To(BeNumerically(">=", 3*paginated.Lists))
+	for _, key := range []string{"full/events", "paginated/events"} {
+		g.Expect(results.Stats[key].TooManyRequests).To(BeNumerically(">", 0))
+		g.Expect(results.Stats[key].Requests).To(Equal(results.Stats[key].TooManyRequests))
+	}
+}
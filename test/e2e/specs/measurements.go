@@ -0,0 +1,206 @@
+package specs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+const (
+	// clusterloader2 names its summary files <SummaryName>_<TestName>_<Timestamp>.json, where SummaryName is
+	// derived from the measurement that produced it.
+	timerSummaryPrefix                = "Timer_"
+	schedulingThroughputSummaryPrefix = "SchedulingThroughput_"
+	podStartupLatencySummaryPrefix    = "PodStartupLatency_"
+
+	// overallDurationTimer is the Timer label every workload config uses for the whole test run.
+	overallDurationTimer = "overall duration"
+	// podStartupMetric is the PodStartupLatency metric covering pod creation through to the pod being observed running.
+	podStartupMetric = "pod_startup"
+)
+
+type (
+	// PerfData mirrors the perf-dash format clusterloader2 uses for most measurement summaries.
+	PerfData struct {
+		Version   string     `json:"version"`
+		DataItems []DataItem `json:"dataItems"`
+	}
+
+	// DataItem is a single labelled set of values within a PerfData summary.
+	DataItem struct {
+		Data   map[string]float64 `json:"data"`
+		Unit   string             `json:"unit"`
+		Labels map[string]string  `json:"labels,omitempty"`
+	}
+
+	// SchedulingThroughput is the SchedulingThroughput measurement summary, in pods scheduled per second.
+	SchedulingThroughput struct {
+		Average float64 `json:"average"`
+		Perc50  float64 `json:"perc50"`
+		Perc90  float64 `json:"perc90"`
+		Perc99  float64 `json:"perc99"`
+		Max     float64 `json:"max"`
+	}
+
+	// LatencyPercentiles holds the percentiles reported for a single PodStartupLatency metric.
+	LatencyPercentiles struct {
+		Perc50 time.Duration `json:"perc50"`
+		Perc90 time.Duration `json:"perc90"`
+		Perc99 time.Duration `json:"perc99"`
+	}
+
+	// ClusterLoader2Results are the measurements parsed from a clusterloader2 report directory.
+	ClusterLoader2Results struct {
+		// Timers maps each Timer label, e.g. "overall duration", to its measured duration
+		Timers map[string]time.Duration `json:"timers,omitempty"`
+		// SchedulingThroughput is nil when the workload did not gather the SchedulingThroughput measurement
+		SchedulingThroughput *SchedulingThroughput `json:"schedulingThroughput,omitempty"`
+		// PodStartupLatency maps each PodStartupLatency metric, e.g. "pod_startup", to its percentiles
+		PodStartupLatency map[string]LatencyPercentiles `json:"podStartupLatency,omitempty"`
+	}
+
+	// ClusterLoader2SLO declares the thresholds a workload run must meet. Zero values are not checked.
+	ClusterLoader2SLO struct {
+		// MinSchedulingThroughput is the minimum average number of pods scheduled per second
+		MinSchedulingThroughput float64
+		// MaxPodStartupLatencyP50 is the maximum 50th percentile pod startup latency
+		MaxPodStartupLatencyP50 time.Duration
+		// MaxPodStartupLatencyP99 is the maximum 99th percentile pod startup latency
+		MaxPodStartupLatencyP99 time.Duration
+		// MaxOverallDuration is the maximum wall clock time of the whole workload, as reported by its Timer
+		MaxOverallDuration time.Duration
+	}
+)
+
+// ParseClusterLoader2Results reads the JSON summaries clusterloader2 wrote into reportDir since the run started, so
+// summaries left behind by an earlier run are never taken for those of a run that failed to write its own. Summaries
+// for measurements the workload did not gather are left empty, and a zero since reads all summaries.
+func ParseClusterLoader2Results(reportDir string, since time.Time) (*ClusterLoader2Results, error) {
+	files, err := ioutil.ReadDir(reportDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading clusterloader2 report directory %s", reportDir)
+	}
+	// the summary timestamp is part of the file name, so sorting makes the most recent summary win
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		// file systems may keep modification times to the second only
+		if !f.IsDir() && filepath.Ext(f.Name()) == ".json" && !f.ModTime().Before(since.Truncate(time.Second)) {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+
+	results := &ClusterLoader2Results{
+		Timers:            map[string]time.Duration{},
+		PodStartupLatency: map[string]LatencyPercentiles{},
+	}
+	for _, name := range names {
+		path := filepath.Join(reportDir, name)
+		switch {
+		case strings.HasPrefix(name, timerSummaryPrefix):
+			data, err := readPerfData(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range data.DataItems {
+				results.Timers[item.Labels["Test"]] = toDuration(item.Data["time"], item.Unit)
+			}
+		case strings.HasPrefix(name, schedulingThroughputSummaryPrefix):
+			throughput := &SchedulingThroughput{}
+			if err := readJSON(path, throughput); err != nil {
+				return nil, err
+			}
+			results.SchedulingThroughput = throughput
+		case strings.HasPrefix(name, podStartupLatencySummaryPrefix):
+			data, err := readPerfData(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range data.DataItems {
+				results.PodStartupLatency[item.Labels["Metric"]] = LatencyPercentiles{
+					Perc50: toDuration(item.Data["Perc50"], item.Unit),
+					Perc90: toDuration(item.Data["Perc90"], item.Unit),
+					Perc99: toDuration(item.Data["Perc99"], item.Unit),
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// ExpectClusterLoader2SLOs fails the current spec if any threshold configured in slo is breached by results.
+// A threshold is also breached if the measurement it depends on was not reported by clusterloader2.
+func ExpectClusterLoader2SLOs(results *ClusterLoader2Results, slo ClusterLoader2SLO) {
+	Expect(results).NotTo(BeNil(), "clusterloader2 results are required to check SLOs")
+	if slo.MinSchedulingThroughput > 0 {
+		Expect(results.SchedulingThroughput).NotTo(BeNil(), "SchedulingThroughput was not reported by clusterloader2")
+		utils.Logf("scheduling throughput average is %.2f pods/s, SLO minimum is %.2f pods/s", results.SchedulingThroughput.Average, slo.MinSchedulingThroughput)
+		Expect(results.SchedulingThroughput.Average).To(BeNumerically(">=", slo.MinSchedulingThroughput), "scheduling throughput is below SLO")
+	}
+	if slo.MaxPodStartupLatencyP50 > 0 || slo.MaxPodStartupLatencyP99 > 0 {
+		Expect(results.PodStartupLatency).To(HaveKey(podStartupMetric), "PodStartupLatency was not reported by clusterloader2")
+		latency := results.PodStartupLatency[podStartupMetric]
+		utils.Logf("pod startup latency is p50=%s p90=%s p99=%s", latency.Perc50, latency.Perc90, latency.Perc99)
+		if slo.MaxPodStartupLatencyP50 > 0 {
+			Expect(latency.Perc50).To(BeNumerically("<=", slo.MaxPodStartupLatencyP50), "p50 pod startup latency is above SLO")
+		}
+		if slo.MaxPodStartupLatencyP99 > 0 {
+			Expect(latency.Perc99).To(BeNumerically("<=", slo.MaxPodStartupLatencyP99), "p99 pod startup latency is above SLO")
+		}
+	}
+	if slo.MaxOverallDuration > 0 {
+		Expect(results.Timers).To(HaveKey(overallDurationTimer), "the %q Timer was not reported by clusterloader2", overallDurationTimer)
+		utils.Logf("overall duration is %s, SLO maximum is %s", results.Timers[overallDurationTimer], slo.MaxOverallDuration)
+		Expect(results.Timers[overallDurationTimer]).To(BeNumerically("<=", slo.MaxOverallDuration), "overall duration is above SLO")
+	}
+}
+
+func readPerfData(path string) (*PerfData, error) {
+	data := &PerfData{}
+	if err := readJSON(path, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeJSON writes v to path as indented JSON.
+func writeJSON(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "rendering %s", path)
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	return nil
+}
+
+func readJSON(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "reading clusterloader2 summary %s", path)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.Wrapf(err, "parsing clusterloader2 summary %s", path)
+	}
+	return nil
+}
+
+// toDuration converts a clusterloader2 value in the given unit to a time.Duration.
+func toDuration(value float64, unit string) time.Duration {
+	switch unit {
+	case "ms":
+		return time.Duration(value * float64(time.Millisecond))
+	case "us":
+		return time.Duration(value * float64(time.Microsecond))
+	default:
+		return time.Duration(value * float64(time.Second))
+	}
+}
@@ -0,0 +1,65 @@
+package specs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseClusterLoader2Results(t *testing.T) {
+	g := NewWithT(t)
+
+	results, err := ParseClusterLoader2Results("testdata/clusterloader2", time.Time{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(results.Timers).To(HaveLen(2))
+	g.Expect(results.Timers[overallDurationTimer]).To(Equal(time.Duration(1832.51 * float64(time.Second))))
+
+	g.Expect(results.SchedulingThroughput).NotTo(BeNil())
+	g.Expect(results.SchedulingThroughput.Average).To(Equal(23.85))
+	g.Expect(results.SchedulingThroughput.Max).To(Equal(40.6))
+
+	g.Expect(results.PodStartupLatency).To(HaveKey(podStartupMetric))
+	latency := results.PodStartupLatency[podStartupMetric]
+	g.Expect(latency.Perc50).To(Equal(1520500 * time.Microsecond))
+	g.Expect(latency.Perc99).To(Equal(4210250 * time.Microsecond))
+	g.Expect(results.PodStartupLatency["create_to_schedule"].Perc90).To(Equal(40 * time.Millisecond))
+}
+
+func TestParseClusterLoader2ResultsIgnoresEarlierRuns(t *testing.T) {
+	g := NewWithT(t)
+	reportDir := t.TempDir()
+	files, err := ioutil.ReadDir("testdata/clusterloader2")
+	g.Expect(err).NotTo(HaveOccurred())
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join("testdata/clusterloader2", f.Name()))
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(ioutil.WriteFile(filepath.Join(reportDir, f.Name()), b, 0644)).To(Succeed())
+	}
+	// an earlier run wrote every summary but the timers, which this run died before writing
+	start := time.Now()
+	earlier := start.Add(-time.Hour)
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name(), timerSummaryPrefix) {
+			g.Expect(os.Chtimes(filepath.Join(reportDir, f.Name()), earlier, earlier)).To(Succeed())
+		}
+	}
+
+	results, err := ParseClusterLoader2Results(reportDir, start)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(results.Timers).To(HaveKey(overallDurationTimer))
+	g.Expect(results.SchedulingThroughput).To(BeNil())
+	g.Expect(results.PodStartupLatency).To(BeEmpty())
+}
+
+func TestParseClusterLoader2ResultsMissingDir(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := ParseClusterLoader2Results("testdata/does-not-exist", time.Time{})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,494 @@
+package specs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// NamespaceLifecycleWorkload names the measurements of the namespace lifecycle workload, which runs without
+// clusterloader2.
+const NamespaceLifecycleWorkload = "namespace-lifecycle"
+
+type (
+	// NamespaceLifecycleConfig configures RunNamespaceLifecycle.
+	NamespaceLifecycleConfig struct {
+		// TestID labels every namespace and object the run creates, and prefixes the namespace names
+		TestID string
+		// Namespaces is the number of namespaces to create and delete
+		Namespaces int
+		// NamespaceRate is the target number of namespaces created per second, and then deleted per second
+		NamespaceRate int
+		// ConfigMapsPerNamespace, SecretsPerNamespace, ServicesPerNamespace and PodsPerNamespace make up the object mix
+		// each namespace is populated with
+		ConfigMapsPerNamespace int
+		SecretsPerNamespace    int
+		ServicesPerNamespace   int
+		PodsPerNamespace       int
+		// DeleteContentsFirst explicitly deletes the objects of each namespace before deleting the namespace, like
+		// CL2_CLEANUP=1 does, instead of leaving them to the namespace controller
+		DeleteContentsFirst bool
+		// TerminationTimeout is how long to wait for all namespaces to be gone, after which the remaining ones are
+		// reported as stuck in Terminating. It also bounds waiting for a namespace left over from an earlier run with
+		// the same TestID to be gone before creating it again.
+		TerminationTimeout time.Duration
+		// SLO declares the thresholds the results must meet for the spec to pass
+		SLO NamespaceLifecycleSLO
+	}
+
+	// NamespaceLifecycleSLO declares the thresholds the results of RunNamespaceLifecycle must meet, zero values are
+	// not checked.
+	NamespaceLifecycleSLO struct {
+		// MaxTerminationP99 is the maximum 99th percentile time for a namespace to be gone after its deletion started
+		MaxTerminationP99 time.Duration
+	}
+
+	// NamespaceLifecycleResults are the namespace lifecycle latencies measured by RunNamespaceLifecycle.
+	NamespaceLifecycleResults struct {
+		// Namespaces is the number of namespaces created
+		Namespaces int `json:"namespaces"`
+		// Populated is how many of them were populated with their whole object mix
+		Populated int `json:"populated"`
+		// Terminated is how many of them were observed gone after being deleted
+		Terminated int `json:"terminated"`
+		// TimeToPopulated holds the percentiles of the time from creating a namespace to having created all objects of
+		// its object mix in it
+		TimeToPopulated LatencyPercentiles `json:"timeToPopulated"`
+		// TimeToTerminated holds the percentiles of the time from starting to tear a namespace down, including the
+		// explicit deletion of its objects with DeleteContentsFirst, to observing it gone
+		TimeToTerminated LatencyPercentiles `json:"timeToTerminated"`
+		// CreateDuration and DeleteDuration are how long creating and tearing down all the namespaces took
+		CreateDuration time.Duration `json:"createDuration"`
+		DeleteDuration time.Duration `json:"deleteDuration"`
+		// Stuck are the namespaces still Terminating after TerminationTimeout
+		Stuck []StuckNamespace `json:"stuck,omitempty"`
+	}
+
+	// StuckNamespace is a namespace that was still Terminating after the termination timeout.
+	StuckNamespace struct {
+		Name string `json:"name"`
+		// Conditions are the namespace conditions that are true, e.g. NamespaceContentRemaining, with their messages
+		Conditions []string `json:"conditions"`
+	}
+
+	namespaceLifecycle struct {
+		clientSet kubernetes.Interface
+		config    NamespaceLifecycleConfig
+
+		mu         sync.Mutex
+		namespaces map[string]*namespaceLifecycleRecord
+	}
+
+	namespaceLifecycleRecord struct {
+		// uid tells the namespace of the run from one of the same name left over from an earlier run
+		uid        types.UID
+		created    time.Time
+		populated  time.Time
+		deleting   time.Time
+		terminated time.Time
+	}
+)
+
+// Validate checks the config for values RunNamespaceLifecycle can't run with.
+func (c NamespaceLifecycleConfig) Validate() error {
+	var errs field.ErrorList
+	if c.TestID == "" {
+		errs = append(errs, field.Required(field.NewPath("TestID"), "is used to name and label namespaces"))
+	}
+	errs = append(errs, validatePositive(field.NewPath("Namespaces"), c.Namespaces)...)
+	errs = append(errs, validatePositive(field.NewPath("NamespaceRate"), c.NamespaceRate)...)
+	for name, value := range map[string]int{
+		"ConfigMapsPerNamespace": c.ConfigMapsPerNamespace,
+		"SecretsPerNamespace":    c.SecretsPerNamespace,
+		"ServicesPerNamespace":   c.ServicesPerNamespace,
+		"PodsPerNamespace":       c.PodsPerNamespace,
+	} {
+		if value < 0 {
+			errs = append(errs, field.Invalid(field.NewPath(name), value, "must not be negative"))
+		}
+	}
+	if c.TerminationTimeout <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("TerminationTimeout"), c.TerminationTimeout, "must be greater than zero"))
+	}
+	return errs.ToAggregate()
+}
+
+// RunNamespaceLifecycleTest runs the namespace lifecycle workload against the input cluster, writes its results to
+// namespace-lifecycle.json among the measurements of the cluster, and fails the spec if the run fails, a namespace
+// gets stuck in Terminating or the results breach the SLO.
+func RunNamespaceLifecycleTest(ctx context.Context, input ClusterTestInput, config NamespaceLifecycleConfig) *NamespaceLifecycleResults {
+	specName := "run-namespace-lifecycle-tests"
+	Expect(input.BootstrapClusterProxy).NotTo(BeNil(), "Invalid argument. input.BootstrapClusterProxy can't be nil when calling %s spec", specName)
+	Expect(input.Cluster).NotTo(BeNil(), "Invalid argument. input.Cluster can't be nil when calling %s spec", specName)
+	Expect(input.ArtifactFolder).NotTo(BeEmpty(), "Invalid argument. input.ArtifactFolder can't be empty when calling %s spec", specName)
+	Expect(config.Validate()).To(Succeed(), "Invalid parameters for workload %q", NamespaceLifecycleWorkload)
+
+	clusterProxy := input.BootstrapClusterProxy.GetWorkloadCluster(ctx, input.Cluster.Namespace, input.Cluster.Name)
+	// the default client side rate limit would throttle populating the namespaces far below the target rate
+	restConfig := rest.CopyConfig(clusterProxy.GetRESTConfig())
+	restConfig.QPS = float32(nativeChurnWorkers)
+	restConfig.Burst = 2 * nativeChurnWorkers
+	clientSet, err := kubernetes.NewForConfig(restConfig)
+	Expect(err).ToNot(HaveOccurred())
+
+	runID := workloadRunID(input, NamespaceLifecycleWorkload)
+	summary := input.Summary.startWorkload(input.Cluster.Name, runID, NamespaceLifecycleWorkload, config)
+	passed := false
+	defer func() { summary.finish(passed) }()
+	eventsCtx, stopEventInformer := context.WithCancel(ctx)
+	defer stopEventInformer()
+	stopRecordingEvents := recordWorkloadEvents(eventsCtx, informers.NewSharedInformerFactory(clusterProxy.GetClientSet(), 0), input, runID)
+	stopSamplingNodes := recordWorkloadNodeResources(ctx, clusterProxy.GetClientSet(), input, runID)
+	results, err := RunNamespaceLifecycle(ctx, clientSet, config)
+	stopRecordingEvents()
+	summary.measured(stopSamplingNodes().summaryMeasurements())
+	if results != nil {
+		summary.measured(results.summaryMeasurements())
+		measurementsDir := workloadMeasurementsDir(input, runID)
+		Expect(writeJSON(filepath.Join(measurementsDir, "namespace-lifecycle.json"), results)).To(Succeed())
+	}
+	Expect(err).ToNot(HaveOccurred(), "namespace lifecycle workload failed against cluster %s", clusterProxy.GetName())
+	ExpectNamespaceLifecycleSLOs(results, config.SLO)
+	passed = true
+	return results
+}
+
+// RunNamespaceLifecycle creates Namespaces namespaces at NamespaceRate, populating each with the configured object
+// mix, and then tears them down at NamespaceRate. It watches the namespaces throughout,
+// so both creation and termination are timed with the same clock. Namespaces still Terminating after
+// TerminationTimeout are reported as stuck and left in place for investigation. Results are returned as far as they
+// got, also when an error is.
+func RunNamespaceLifecycle(ctx context.Context, clientSet kubernetes.Interface, config NamespaceLifecycleConfig) (*NamespaceLifecycleResults, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	l := &namespaceLifecycle{
+		clientSet:  clientSet,
+		config:     config,
+		namespaces: map[string]*namespaceLifecycleRecord{},
+	}
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	if err := l.watch(watchCtx); err != nil {
+		return nil, err
+	}
+
+	results := &NamespaceLifecycleResults{}
+	limiter := flowcontrol.NewTokenBucketRateLimiter(float32(config.NamespaceRate), 1)
+	defer limiter.Stop()
+	var ops []func(context.Context) error
+	for i := 1; i <= config.Namespaces; i++ {
+		ns := fmt.Sprintf("%s-%d", config.TestID, i)
+		ops = append(ops, func(ctx context.Context) error { return l.createNamespace(ctx, ns) })
+	}
+	start := time.Now()
+	err := runRateLimited(ctx, limiter, ops)
+	results.CreateDuration = time.Since(start)
+	if err != nil {
+		return l.results(results), err
+	}
+
+	ops = nil
+	for i := 1; i <= config.Namespaces; i++ {
+		ns := fmt.Sprintf("%s-%d", config.TestID, i)
+		ops = append(ops, func(ctx context.Context) error { return l.deleteNamespace(ctx, ns) })
+	}
+	start = time.Now()
+	err = runRateLimited(ctx, limiter, ops)
+	if err != nil {
+		results.DeleteDuration = time.Since(start)
+		return l.results(results), err
+	}
+	if err := l.waitFor(ctx, config.TerminationTimeout, func(r *namespaceLifecycleRecord) bool { return !r.terminated.IsZero() }); err != nil {
+		results.Stuck, err = l.stuckNamespaces(ctx)
+		if err != nil {
+			results.DeleteDuration = time.Since(start)
+			return l.results(results), err
+		}
+	}
+	results.DeleteDuration = time.Since(start)
+	return l.results(results), nil
+}
+
+// watch starts watching the namespaces of the run, recording when each is observed gone.
+func (l *namespaceLifecycle) watch(ctx context.Context) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(l.clientSet, 0,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = fmt.Sprintf("%s=%s", testIDLabel, l.config.TestID)
+		}))
+	informer := factory.Core().V1().Namespaces().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { l.observe(obj, false, time.Now()) },
+		UpdateFunc: func(_, obj interface{}) { l.observe(obj, false, time.Now()) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			l.observe(obj, true, time.Now())
+		},
+	})
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return errors.New("timed out waiting for the namespace informer to sync")
+	}
+	return nil
+}
+
+func (l *namespaceLifecycle) observe(obj interface{}, deleted bool, now time.Time) {
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// namespaces left over from an earlier run are not part of this one
+	r, ok := l.namespaces[ns.Name]
+	if !ok || ns.UID != r.uid {
+		return
+	}
+	if r.terminated.IsZero() && deleted {
+		r.terminated = now
+	}
+}
+
+// createNamespace creates the namespace ns and then its objects. A namespace of the same name left over from an
+// earlier run is deleted first, waiting up to TerminationTimeout for it to be gone.
+func (l *namespaceLifecycle) createNamespace(ctx context.Context, name string) error {
+	labels := map[string]string{testIDLabel: l.config.TestID}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	created := time.Now()
+	ns, err := l.clientSet.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		utils.Logf("namespace %s is left over from an earlier run, waiting for it to be gone", name)
+		if err := l.deleteLeftover(ctx, name); err != nil {
+			return err
+		}
+		ns = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+		created = time.Now()
+		ns, err = l.clientSet.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "creating namespace %s", name)
+	}
+	r := &namespaceLifecycleRecord{uid: ns.UID, created: created}
+	l.mu.Lock()
+	l.namespaces[name] = r
+	l.mu.Unlock()
+
+	core := l.clientSet.CoreV1()
+	for i := 0; i < l.config.ConfigMapsPerNamespace; i++ {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("configmap-%d", i), Labels: labels},
+			Data:       map[string]string{"data": name},
+		}
+		if _, err := core.ConfigMaps(name).Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			return errors.Wrapf(err, "creating configmap %s/%s", name, cm.Name)
+		}
+	}
+	for i := 0; i < l.config.SecretsPerNamespace; i++ {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("secret-%d", i), Labels: labels},
+			StringData: map[string]string{"data": name},
+		}
+		if _, err := core.Secrets(name).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return errors.Wrapf(err, "creating secret %s/%s", name, secret.Name)
+		}
+	}
+	for i := 0; i < l.config.ServicesPerNamespace; i++ {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("service-%d", i), Labels: labels},
+			Spec: corev1.ServiceSpec{
+				Selector: labels,
+				Ports:    []corev1.ServicePort{{Port: 80}},
+			},
+		}
+		if _, err := core.Services(name).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+			return errors.Wrapf(err, "creating service %s/%s", name, service.Name)
+		}
+	}
+	for i := 0; i < l.config.PodsPerNamespace; i++ {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), Labels: labels},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "load-test", Image: nativeChurnImage}},
+			},
+		}
+		if _, err := core.Pods(name).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			return errors.Wrapf(err, "creating pod %s/%s", name, pod.Name)
+		}
+	}
+	l.mu.Lock()
+	r.populated = time.Now()
+	l.mu.Unlock()
+	return nil
+}
+
+// deleteLeftover deletes the namespace name left over from an earlier run, unless it is already terminating, and
+// waits up to TerminationTimeout for it to be gone.
+func (l *namespaceLifecycle) deleteLeftover(ctx context.Context, name string) error {
+	namespaces := l.clientSet.CoreV1().Namespaces()
+	if err := namespaces.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "deleting namespace %s left over from an earlier run", name)
+	}
+	err := wait.PollImmediate(time.Second, l.config.TerminationTimeout, func() (bool, error) {
+		_, err := namespaces.Get(ctx, name, metav1.GetOptions{})
+		return apierrors.IsNotFound(err), nil
+	})
+	return errors.Wrapf(err, "waiting for namespace %s left over from an earlier run to be gone", name)
+}
+
+// deleteNamespace deletes the namespace ns, first deleting its objects one by one with DeleteContentsFirst.
+func (l *namespaceLifecycle) deleteNamespace(ctx context.Context, name string) error {
+	l.mu.Lock()
+	r, ok := l.namespaces[name]
+	if ok {
+		r.deleting = time.Now()
+	}
+	l.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if l.config.DeleteContentsFirst {
+		core := l.clientSet.CoreV1()
+		var errs []error
+		deleteObject := func(kind, objectName string, del func(context.Context, string, metav1.DeleteOptions) error) {
+			if err := del(ctx, objectName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, errors.Wrapf(err, "deleting %s %s/%s", kind, name, objectName))
+			}
+		}
+		for i := 0; i < l.config.ConfigMapsPerNamespace; i++ {
+			deleteObject("configmap", fmt.Sprintf("configmap-%d", i), core.ConfigMaps(name).Delete)
+		}
+		for i := 0; i < l.config.SecretsPerNamespace; i++ {
+			deleteObject("secret", fmt.Sprintf("secret-%d", i), core.Secrets(name).Delete)
+		}
+		for i := 0; i < l.config.ServicesPerNamespace; i++ {
+			deleteObject("service", fmt.Sprintf("service-%d", i), core.Services(name).Delete)
+		}
+		for i := 0; i < l.config.PodsPerNamespace; i++ {
+			deleteObject("pod", fmt.Sprintf("pod-%d", i), core.Pods(name).Delete)
+		}
+		if len(errs) > 0 {
+			return utilerrors.NewAggregate(errs)
+		}
+	}
+	if err := l.clientSet.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "deleting namespace %s", name)
+	}
+	return nil
+}
+
+// waitFor waits until done is true for every namespace of the run, or timeout.
+func (l *namespaceLifecycle) waitFor(ctx context.Context, timeout time.Duration, done func(*namespaceLifecycleRecord) bool) error {
+	return wait.PollImmediate(time.Second, timeout, func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, r := range l.namespaces {
+			if !done(r) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+// stuckNamespaces returns the namespaces of the run that still exist, with the conditions that tell what holds them up.
+func (l *namespaceLifecycle) stuckNamespaces(ctx context.Context) ([]StuckNamespace, error) {
+	l.mu.Lock()
+	var names []string
+	for name, r := range l.namespaces {
+		if r.terminated.IsZero() {
+			names = append(names, name)
+		}
+	}
+	l.mu.Unlock()
+	sort.Strings(names)
+
+	var stuck []StuckNamespace
+	for _, name := range names {
+		ns, err := l.clientSet.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// gone by now, just not observed in time
+			continue
+		}
+		if err != nil {
+			return stuck, errors.Wrapf(err, "getting namespace %s", name)
+		}
+		s := StuckNamespace{Name: name}
+		for _, c := range ns.Status.Conditions {
+			if c.Status == corev1.ConditionTrue {
+				s.Conditions = append(s.Conditions, fmt.Sprintf("%s: %s", c.Type, c.Message))
+			}
+		}
+		utils.Logf("namespace %s is stuck in %s: %v", name, ns.Status.Phase, s.Conditions)
+		stuck = append(stuck, s)
+	}
+	return stuck, nil
+}
+
+// results fills in results with the latencies observed so far.
+func (l *namespaceLifecycle) results(results *NamespaceLifecycleResults) *NamespaceLifecycleResults {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var toPopulated, toTerminated []time.Duration
+	for _, r := range l.namespaces {
+		if !r.populated.IsZero() {
+			toPopulated = append(toPopulated, r.populated.Sub(r.created))
+		}
+		if !r.terminated.IsZero() && !r.deleting.IsZero() {
+			toTerminated = append(toTerminated, r.terminated.Sub(r.deleting))
+		}
+	}
+	results.Namespaces = len(l.namespaces)
+	results.Populated = len(toPopulated)
+	results.Terminated = len(toTerminated)
+	results.TimeToPopulated = latencyPercentiles(toPopulated)
+	results.TimeToTerminated = latencyPercentiles(toTerminated)
+	utils.Logf("namespace lifecycle %s: %d namespaces, %d populated (p99 %s), %d observed terminated (p99 %s), %d stuck",
+		l.config.TestID, results.Namespaces, results.Populated, results.TimeToPopulated.Perc99, results.Terminated, results.TimeToTerminated.Perc99, len(results.Stuck))
+	return results
+}
+
+// summaryMeasurements returns the key measurements of the namespace lifecycle workload for the run summary.
+func (r *NamespaceLifecycleResults) summaryMeasurements() map[string]float64 {
+	return map[string]float64{
+		"namespace_time_to_populated_p99_seconds":  r.TimeToPopulated.Perc99.Seconds(),
+		"namespace_time_to_terminated_p99_seconds": r.TimeToTerminated.Perc99.Seconds(),
+		"namespaces_stuck":                         float64(len(r.Stuck)),
+	}
+}
+
+// ExpectNamespaceLifecycleSLOs fails the current spec if a namespace got stuck in Terminating or the time to
+// terminate namespaces breaches slo.
+func ExpectNamespaceLifecycleSLOs(results *NamespaceLifecycleResults, slo NamespaceLifecycleSLO) {
+	Expect(results).NotTo(BeNil(), "namespace lifecycle results are required to check SLOs")
+	Expect(results.Stuck).To(BeEmpty(), "namespaces are stuck in Terminating")
+	if slo.MaxTerminationP99 == 0 {
+		return
+	}
+	utils.Logf("namespace termination latency is p99=%s, SLO maximum is %s", results.TimeToTerminated.Perc99, slo.MaxTerminationP99)
+	Expect(results.TimeToTerminated.Perc99).To(BeNumerically("<=", slo.MaxTerminationP99), "p99 namespace termination latency is above SLO")
+}
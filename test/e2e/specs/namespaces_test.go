@@ -0,0 +1,69 @@
+package specs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRunNamespaceLifecycle(t *testing.T) {
+	g := NewWithT(t)
+	// a namespace left over from an earlier run with the same TestID is deleted before creating it again
+	leftover := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "lifecycle-3", UID: "leftover", Labels: map[string]string{testIDLabel: "lifecycle"}}}
+	clientSet := fake.NewSimpleClientset(leftover)
+	// the fake clientset deletes namespaces right away, except for one that gets stuck on its remaining content
+	var podDeletes int
+	clientSet.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		podDeletes++
+		return false, nil, nil
+	})
+	clientSet.PrependReactor("delete", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.DeleteAction).GetName() != "lifecycle-2" {
+			return false, nil, nil
+		}
+		stuck := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "lifecycle-2", Labels: map[string]string{testIDLabel: "lifecycle"}},
+			Status: corev1.NamespaceStatus{
+				Phase: corev1.NamespaceTerminating,
+				Conditions: []corev1.NamespaceCondition{
+					{Type: corev1.NamespaceContentRemaining, Status: corev1.ConditionTrue, Message: "Some resources are remaining: pods. has 1 resource instances"},
+					{Type: corev1.NamespaceDeletionDiscoveryFailure, Status: corev1.ConditionFalse},
+				},
+			},
+		}
+		return true, nil, clientSet.Tracker().Update(corev1.SchemeGroupVersion.WithResource("namespaces"), stuck, "")
+	})
+
+	results, err := RunNamespaceLifecycle(context.Background(), clientSet, NamespaceLifecycleConfig{
+		TestID:                 "lifecycle",
+		Namespaces:             3,
+		NamespaceRate:          100,
+		ConfigMapsPerNamespace: 2,
+		SecretsPerNamespace:    1,
+		ServicesPerNamespace:   1,
+		PodsPerNamespace:       2,
+		DeleteContentsFirst:    true,
+		TerminationTimeout:     2 * time.Second,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(results.Namespaces).To(Equal(3))
+	g.Expect(results.Populated).To(Equal(3))
+	g.Expect(results.TimeToPopulated.Perc99).To(BeNumerically(">", 0))
+	g.Expect(results.Terminated).To(Equal(2))
+	g.Expect(podDeletes).To(Equal(6))
+	g.Expect(results.Stuck).To(Equal([]StuckNamespace{{
+		Name:       "lifecycle-2",
+		Conditions: []string{"NamespaceContentRemaining: Some resources are remaining: pods. has 1 resource instances"},
+	}}))
+
+	configMaps, err := clientSet.CoreV1().ConfigMaps("lifecycle-1").List(context.Background(), metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(configMaps.Items).To(BeEmpty())
+}
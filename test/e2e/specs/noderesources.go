@@ -0,0 +1,341 @@
+package specs
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodeResourceSampleInterval is how often the sampler queries the kubelet of each node while a workload runs.
+const nodeResourceSampleInterval = 15 * time.Second
+
+type (
+	// ResourceUsage is the CPU and memory used by a node or a container at one point in time.
+	ResourceUsage struct {
+		// CPUCores is the CPU used, averaged by the kubelet over its last housekeeping interval
+		CPUCores float64 `json:"cpuCores"`
+		// MemoryWorkingSetBytes is the memory used that can't be evicted, what the kubelet evicts pods on
+		MemoryWorkingSetBytes uint64 `json:"memoryWorkingSetBytes"`
+	}
+
+	// NodeResourceSample is the resources used on a node at one point in time, as its kubelet reported them.
+	NodeResourceSample struct {
+		Time time.Time `json:"time"`
+		Node string    `json:"node"`
+		ResourceUsage
+		// Pods is the number of pods the kubelet reported stats of
+		Pods int `json:"pods"`
+		// SystemContainers are the resources used by the system containers of the node, e.g. "kubelet" and "runtime"
+		SystemContainers map[string]ResourceUsage `json:"systemContainers,omitempty"`
+	}
+
+	// ResourceUsageStats are the max and average of the samples of a node or a system container.
+	ResourceUsageStats struct {
+		Max     ResourceUsage `json:"max"`
+		Average ResourceUsage `json:"average"`
+	}
+
+	// NodeResourceStats summarizes the samples of one node.
+	NodeResourceStats struct {
+		// Samples is the number of samples taken, Failures the number of times the kubelet couldn't be queried
+		Samples  int `json:"samples"`
+		Failures int `json:"failures"`
+		// AllocatableCPUCores and AllocatableMemoryBytes are what the node offers to pods, to put the usage in perspective
+		AllocatableCPUCores    float64 `json:"allocatableCPUCores"`
+		AllocatableMemoryBytes int64   `json:"allocatableMemoryBytes"`
+		ResourceUsageStats
+		MaxPods     int     `json:"maxPods"`
+		AveragePods float64 `json:"averagePods"`
+		// SystemContainers are the stats of each system container of the node
+		SystemContainers map[string]ResourceUsageStats `json:"systemContainers,omitempty"`
+	}
+
+	// NodeResourceResults are the resources used on the nodes of a cluster while a workload ran.
+	NodeResourceResults struct {
+		Interval time.Duration `json:"interval"`
+		// Samples is the time series of every node, ordered by time and node
+		Samples []NodeResourceSample `json:"samples"`
+		// Nodes are the stats of each node by name
+		Nodes map[string]*NodeResourceStats `json:"nodes"`
+	}
+
+	// NodeResourceSampler periodically queries the kubelet summary API of every node of a cluster, through the API
+	// server proxy, until stopped.
+	NodeResourceSampler struct {
+		clientSet kubernetes.Interface
+		interval  time.Duration
+		cancel    context.CancelFunc
+		done      chan struct{}
+		stopOnce  sync.Once
+
+		mu      sync.Mutex
+		samples []NodeResourceSample
+		nodes   map[string]*NodeResourceStats
+	}
+
+	// kubeletStatsSummary is the part of the response of the kubelet /stats/summary endpoint the sampler reads, see
+	// k8s.io/kubelet/pkg/apis/stats/v1alpha1.
+	kubeletStatsSummary struct {
+		Node struct {
+			NodeName         string                  `json:"nodeName"`
+			SystemContainers []kubeletContainerStats `json:"systemContainers"`
+			kubeletResourceStats
+		} `json:"node"`
+		Pods []json.RawMessage `json:"pods"`
+	}
+
+	kubeletContainerStats struct {
+		Name string `json:"name"`
+		kubeletResourceStats
+	}
+
+	kubeletResourceStats struct {
+		CPU *struct {
+			UsageNanoCores *uint64 `json:"usageNanoCores"`
+		} `json:"cpu"`
+		Memory *struct {
+			WorkingSetBytes *uint64 `json:"workingSetBytes"`
+		} `json:"memory"`
+	}
+)
+
+// NewNodeResourceSampler returns a sampler of the nodes of the cluster clientSet talks to, sampling every interval.
+func NewNodeResourceSampler(clientSet kubernetes.Interface, interval time.Duration) *NodeResourceSampler {
+	return &NodeResourceSampler{
+		clientSet: clientSet,
+		interval:  interval,
+		done:      make(chan struct{}),
+		nodes:     map[string]*NodeResourceStats{},
+	}
+}
+
+// Start starts sampling, which runs until Stop is called or ctx is done. Nodes added while sampling are sampled from
+// then on.
+func (s *NodeResourceSampler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	go func() {
+		defer close(s.done)
+		wait.UntilWithContext(ctx, func(ctx context.Context) {
+			if err := s.sample(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				utils.Logf("failed to sample node resources: %v", err)
+			}
+		}, s.interval)
+	}()
+}
+
+// Stop stops sampling and returns the samples taken and the stats of each node.
+func (s *NodeResourceSampler) Stop() *NodeResourceResults {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		<-s.done
+	})
+	return s.results()
+}
+
+// sample queries the kubelet of every node once, and records the usage of those that answered.
+func (s *NodeResourceSampler) sample(ctx context.Context, now time.Time) error {
+	nodes, err := s.clientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "listing nodes")
+	}
+	for _, node := range nodes.Items {
+		s.mu.Lock()
+		stats, ok := s.nodes[node.Name]
+		if !ok {
+			stats = &NodeResourceStats{}
+			s.nodes[node.Name] = stats
+		}
+		stats.AllocatableCPUCores = float64(node.Status.Allocatable.Cpu().MilliValue()) / 1000
+		stats.AllocatableMemoryBytes = node.Status.Allocatable.Memory().Value()
+		s.mu.Unlock()
+
+		// a hung kubelet must not hold up sampling the other nodes
+		nodeCtx, cancel := context.WithTimeout(ctx, s.interval)
+		sample, err := s.sampleNode(nodeCtx, node.Name, now)
+		cancel()
+		s.mu.Lock()
+		if err != nil {
+			// a node being busy or going away shouldn't stop the others being sampled
+			if stats.Failures == 0 && ctx.Err() == nil {
+				utils.Logf("failed to sample the resources of node %s, further failures are only counted: %v", node.Name, err)
+			}
+			stats.Failures++
+		} else {
+			s.samples = append(s.samples, *sample)
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+func (s *NodeResourceSampler) sampleNode(ctx context.Context, node string, now time.Time) (*NodeResourceSample, error) {
+	b, err := s.clientSet.CoreV1().RESTClient().Get().AbsPath("/api/v1/nodes", node, "proxy", "stats", "summary").DoRaw(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "querying the kubelet summary API of node %s", node)
+	}
+	summary := &kubeletStatsSummary{}
+	if err := json.Unmarshal(b, summary); err != nil {
+		return nil, errors.Wrapf(err, "parsing the kubelet summary of node %s", node)
+	}
+	sample := &NodeResourceSample{Time: now, Node: node, ResourceUsage: summary.Node.usage(), Pods: len(summary.Pods)}
+	for _, c := range summary.Node.SystemContainers {
+		if sample.SystemContainers == nil {
+			sample.SystemContainers = map[string]ResourceUsage{}
+		}
+		sample.SystemContainers[c.Name] = c.usage()
+	}
+	return sample, nil
+}
+
+func (s *NodeResourceSampler) results() *NodeResourceResults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := &NodeResourceResults{Interval: s.interval, Samples: append([]NodeResourceSample{}, s.samples...), Nodes: map[string]*NodeResourceStats{}}
+	sort.SliceStable(results.Samples, func(i, j int) bool {
+		a, b := results.Samples[i], results.Samples[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		return a.Node < b.Node
+	})
+
+	containers := map[string]map[string][]ResourceUsage{}
+	usages := map[string][]ResourceUsage{}
+	pods := map[string][]int{}
+	for _, sample := range results.Samples {
+		usages[sample.Node] = append(usages[sample.Node], sample.ResourceUsage)
+		pods[sample.Node] = append(pods[sample.Node], sample.Pods)
+		if containers[sample.Node] == nil {
+			containers[sample.Node] = map[string][]ResourceUsage{}
+		}
+		for name, usage := range sample.SystemContainers {
+			containers[sample.Node][name] = append(containers[sample.Node][name], usage)
+		}
+	}
+	for name, node := range s.nodes {
+		stats := &NodeResourceStats{
+			Samples:                len(usages[name]),
+			Failures:               node.Failures,
+			AllocatableCPUCores:    node.AllocatableCPUCores,
+			AllocatableMemoryBytes: node.AllocatableMemoryBytes,
+			ResourceUsageStats:     resourceUsageStats(usages[name]),
+			SystemContainers:       map[string]ResourceUsageStats{},
+		}
+		for _, p := range pods[name] {
+			if p > stats.MaxPods {
+				stats.MaxPods = p
+			}
+			stats.AveragePods += float64(p) / float64(len(pods[name]))
+		}
+		for container, u := range containers[name] {
+			stats.SystemContainers[container] = resourceUsageStats(u)
+		}
+		results.Nodes[name] = stats
+	}
+	return results
+}
+
+// MaxUsage returns the highest CPU and memory used on any node.
+func (r *NodeResourceResults) MaxUsage() ResourceUsage {
+	var max ResourceUsage
+	for _, stats := range r.Nodes {
+		if stats.Max.CPUCores > max.CPUCores {
+			max.CPUCores = stats.Max.CPUCores
+		}
+		if stats.Max.MemoryWorkingSetBytes > max.MemoryWorkingSetBytes {
+			max.MemoryWorkingSetBytes = stats.Max.MemoryWorkingSetBytes
+		}
+	}
+	return max
+}
+
+// summaryMeasurements returns the key node measurements of a workload for the run summary, none if no node could be
+// sampled.
+func (r *NodeResourceResults) summaryMeasurements() map[string]float64 {
+	m := map[string]float64{}
+	if len(r.Samples) > 0 {
+		max := r.MaxUsage()
+		m["node_cpu_max_cores"] = max.CPUCores
+		m["node_memory_working_set_max_bytes"] = float64(max.MemoryWorkingSetBytes)
+	}
+	return m
+}
+
+// recordWorkloadNodeResources samples the resources used on the nodes of the input cluster, and returns a func that
+// stops sampling, writes node-resources.json and node-resource-summary.json among the measurements of the workload run
+// runID, logs the busiest nodes and returns the results. The func can be deferred and also called to get the results,
+// only its first call does the work. Node resources are nice to have, so failing to write them is logged rather than
+// failing the workload.
+func recordWorkloadNodeResources(ctx context.Context, clientSet kubernetes.Interface, input ClusterTestInput, runID string) func() *NodeResourceResults {
+	measurementsDir := workloadMeasurementsDir(input, runID)
+	sampler := NewNodeResourceSampler(clientSet, nodeResourceSampleInterval)
+	sampler.Start(ctx)
+	var once sync.Once
+	var results *NodeResourceResults
+	return func() *NodeResourceResults {
+		once.Do(func() { results = stopWorkloadNodeResources(sampler, measurementsDir, runID) })
+		return results
+	}
+}
+
+// stopWorkloadNodeResources stops sampler, writes and logs its results, see recordWorkloadNodeResources.
+func stopWorkloadNodeResources(sampler *NodeResourceSampler, measurementsDir, runID string) *NodeResourceResults {
+	results := sampler.Stop()
+	if err := writeJSON(filepath.Join(measurementsDir, "node-resources.json"), results.Samples); err != nil {
+		utils.Logf("failed to write the node resources of workload run %q: %v", runID, err)
+	}
+	if err := writeJSON(filepath.Join(measurementsDir, "node-resource-summary.json"), results.Nodes); err != nil {
+		utils.Logf("failed to write the node resource summary of workload run %q: %v", runID, err)
+	}
+	names := make([]string, 0, len(results.Nodes))
+	for name := range results.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stats := results.Nodes[name]
+		utils.Logf("node %s during workload run %q: max %.2f of %.2f CPU cores, max %d of %d bytes of memory, max %d pods, %d samples, %d failures",
+			name, runID, stats.Max.CPUCores, stats.AllocatableCPUCores, stats.Max.MemoryWorkingSetBytes, stats.AllocatableMemoryBytes, stats.MaxPods, stats.Samples, stats.Failures)
+	}
+	return results
+}
+
+func resourceUsageStats(usages []ResourceUsage) ResourceUsageStats {
+	var stats ResourceUsageStats
+	if len(usages) == 0 {
+		return stats
+	}
+	var memory float64
+	for _, u := range usages {
+		if u.CPUCores > stats.Max.CPUCores {
+			stats.Max.CPUCores = u.CPUCores
+		}
+		if u.MemoryWorkingSetBytes > stats.Max.MemoryWorkingSetBytes {
+			stats.Max.MemoryWorkingSetBytes = u.MemoryWorkingSetBytes
+		}
+		stats.Average.CPUCores += u.CPUCores / float64(len(usages))
+		memory += float64(u.MemoryWorkingSetBytes) / float64(len(usages))
+	}
+	stats.Average.MemoryWorkingSetBytes = uint64(memory)
+	return stats
+}
+
+func (s kubeletResourceStats) usage() ResourceUsage {
+	var usage ResourceUsage
+	if s.CPU != nil && s.CPU.UsageNanoCores != nil {
+		usage.CPUCores = float64(*s.CPU.UsageNanoCores) / 1e9
+	}
+	if s.Memory != nil && s.Memory.WorkingSetBytes != nil {
+		usage.MemoryWorkingSetBytes = *s.Memory.WorkingSetBytes
+	}
+	return usage
+}
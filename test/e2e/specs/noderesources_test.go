@@ -0,0 +1,80 @@
+package specs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+func TestNodeResourceSampler(t *testing.T) {
+	g := NewWithT(t)
+	// node-0 uses more with every sample, node-1's kubelet hangs and node-2's doesn't answer
+	cpu := uint64(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/nodes":
+			fmt.Fprint(w, `{"kind":"NodeList","apiVersion":"v1","items":[
+				{"metadata":{"name":"node-0"},"status":{"allocatable":{"cpu":"1900m","memory":"5Gi"}}},
+				{"metadata":{"name":"node-1"},"status":{"allocatable":{"cpu":"1900m","memory":"5Gi"}}},
+				{"metadata":{"name":"node-2"},"status":{"allocatable":{"cpu":"1900m","memory":"5Gi"}}}]}`)
+		case "/api/v1/nodes/node-0/proxy/stats/summary":
+			cpu += 500000000
+			fmt.Fprintf(w, `{"node":{"nodeName":"node-0",
+				"systemContainers":[{"name":"kubelet","cpu":{"usageNanoCores":%d},"memory":{"workingSetBytes":100}},{"name":"runtime"}],
+				"cpu":{"usageNanoCores":%d},"memory":{"workingSetBytes":%d}},
+				"pods":[{},{},{}]}`, cpu/10, cpu, cpu)
+		case "/api/v1/nodes/node-1/proxy/stats/summary":
+			<-r.Context().Done()
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	clientSet, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL, RateLimiter: flowcontrol.NewFakeAlwaysRateLimiter()})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// each kubelet is given as long as the interval to answer
+	s := NewNodeResourceSampler(clientSet, 100*time.Millisecond)
+	start := time.Now()
+	g.Expect(s.sample(context.TODO(), start)).To(Succeed())
+	g.Expect(s.sample(context.TODO(), start.Add(time.Minute))).To(Succeed())
+	results := s.results()
+
+	g.Expect(results.Samples).To(HaveLen(2))
+	g.Expect(results.Samples[1]).To(Equal(NodeResourceSample{
+		Time:          start.Add(time.Minute),
+		Node:          "node-0",
+		ResourceUsage: ResourceUsage{CPUCores: 1, MemoryWorkingSetBytes: 1000000000},
+		Pods:          3,
+		SystemContainers: map[string]ResourceUsage{
+			"kubelet": {CPUCores: 0.1, MemoryWorkingSetBytes: 100},
+			"runtime": {},
+		},
+	}))
+
+	g.Expect(results.Nodes).To(HaveLen(3))
+	node := results.Nodes["node-0"]
+	g.Expect(node.Samples).To(Equal(2))
+	g.Expect(node.AllocatableCPUCores).To(Equal(1.9))
+	g.Expect(node.AllocatableMemoryBytes).To(Equal(int64(5 << 30)))
+	g.Expect(node.Max).To(Equal(ResourceUsage{CPUCores: 1, MemoryWorkingSetBytes: 1000000000}))
+	g.Expect(node.Average).To(Equal(ResourceUsage{CPUCores: 0.75, MemoryWorkingSetBytes: 750000000}))
+	g.Expect(node.MaxPods).To(Equal(3))
+	g.Expect(node.AveragePods).To(Equal(3.0))
+	g.Expect(node.SystemContainers["kubelet"].Max.CPUCores).To(Equal(0.1))
+	g.Expect(results.Nodes["node-1"].Samples).To(BeZero())
+	g.Expect(results.Nodes["node-1"].Failures).To(Equal(2))
+	g.Expect(results.Nodes["node-2"].Failures).To(Equal(2))
+
+	g.Expect(results.MaxUsage()).To(Equal(ResourceUsage{CPUCores: 1, MemoryWorkingSetBytes: 1000000000}))
+	g.Expect((&WorkloadResults{NodeResources: results}).summaryMeasurements()).To(HaveKeyWithValue("node_cpu_max_cores", 1.0))
+}
@@ -0,0 +1,202 @@
+package specs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/cluster-api/test/framework/clusterctl"
+)
+
+const (
+	// metricsFile is the OpenMetrics rendering of the run summary, written to the artifact folder.
+	metricsFile = "metrics.txt"
+	// metricPrefix namespaces every metric knarly exports.
+	metricPrefix = "knarly_"
+	// defaultPushJob is the pushgateway job the metrics are pushed under when KNARLY_PUSHGATEWAY_JOB is not set.
+	defaultPushJob = "knarly"
+)
+
+var invalidMetricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+type (
+	// PushConfig configures pushing the metrics of a run to a pushgateway.
+	PushConfig struct {
+		// URL is the base URL of the pushgateway, e.g. http://localhost:9091
+		URL string
+		// Job is the job the metrics are grouped under
+		Job string
+	}
+
+	// metricFamily is the samples of one gauge.
+	metricFamily struct {
+		help    string
+		samples []metricSample
+	}
+
+	metricSample struct {
+		labels map[string]string
+		value  float64
+	}
+
+	// metricSet collects gauges by name.
+	metricSet map[string]*metricFamily
+)
+
+// ResolvePushConfig reads the pushgateway to push to from the KNARLY_PUSHGATEWAY_URL and KNARLY_PUSHGATEWAY_JOB
+// variables. It returns nil if KNARLY_PUSHGATEWAY_URL is not set, which disables pushing.
+func ResolvePushConfig(e2eConfig *clusterctl.E2EConfig) (*PushConfig, error) {
+	pushURL := optionalVariable(e2eConfig, utils.PushgatewayURL)
+	if pushURL == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(pushURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("%s must be an absolute URL, got %q", utils.PushgatewayURL, pushURL)
+	}
+	config := &PushConfig{URL: strings.TrimSuffix(pushURL, "/"), Job: optionalVariable(e2eConfig, utils.PushgatewayJob)}
+	if config.Job == "" {
+		config.Job = defaultPushJob
+	}
+	return config, nil
+}
+
+// OpenMetrics renders the run summary as OpenMetrics gauges: how long each spec and its log collection took, how long
+// each cluster took to provision, and the duration, outcome and key measurements of each workload. Series of clusters
+// and workloads are labelled with the flavor, region, SKU and Kubernetes version of their cluster, series of specs
+// with those of their first cluster, series of workloads with their run ID, and all series with the Ginkgo node.
+func (r *RunSummary) OpenMetrics() []byte {
+	metrics := metricSet{}
+	for _, s := range r.Specs {
+		specLabels := map[string]string{"spec": s.Spec, "ginkgo_node": strconv.Itoa(s.GinkgoNode)}
+		if len(s.Clusters) > 0 {
+			specLabels = withClusterLabels(specLabels, s.Clusters[0])
+		}
+		metrics.add("spec_duration_seconds", "Wall clock time of the spec.", specLabels, s.Duration.Seconds())
+		metrics.add("spec_passed", "Whether the spec passed.", specLabels, boolValue(s.Passed))
+		metrics.add("log_collection_duration_seconds", "Time taken to collect the logs and resources of the spec.", specLabels, s.LogCollectionDuration.Seconds())
+
+		for _, c := range s.Clusters {
+			labels := withClusterLabels(map[string]string{"spec": s.Spec, "ginkgo_node": strconv.Itoa(s.GinkgoNode), "cluster": c.Name}, c)
+			metrics.add("cluster_provisioning_duration_seconds", "Time taken to provision the cluster until its control plane and nodes were ready.", labels, c.ProvisioningDuration.Seconds())
+			metrics.add("cluster_nodes", "Number of nodes of the cluster once provisioned.", labels, float64(c.Nodes))
+		}
+
+		for _, w := range s.Workloads {
+			// the run ID tells runs of the same workload against the same cluster apart, which would be duplicate series
+			labels := map[string]string{"spec": s.Spec, "ginkgo_node": strconv.Itoa(s.GinkgoNode), "cluster": w.Cluster, "workload": w.Name, "run": w.ID}
+			if c := s.cluster(w.Cluster); c != nil {
+				labels = withClusterLabels(labels, c)
+			}
+			metrics.add("workload_duration_seconds", "Wall clock time of the workload.", labels, w.Duration.Seconds())
+			metrics.add("workload_passed", "Whether the workload passed its SLOs.", labels, boolValue(w.Passed))
+			for measurement, value := range w.Measurements {
+				metrics.add("workload_"+measurement, fmt.Sprintf("The %s measurement of the workload.", measurement), labels, value)
+			}
+		}
+	}
+	return metrics.render()
+}
+
+// WriteOpenMetrics writes the run summary as OpenMetrics to metrics.txt in the artifact folder.
+func WriteOpenMetrics(artifactFolder string, run *RunSummary) error {
+	path := filepath.Join(artifactFolder, metricsFile)
+	if err := ioutil.WriteFile(path, run.OpenMetrics(), 0644); err != nil {
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	return nil
+}
+
+// PushOpenMetrics replaces the metrics of the job in the pushgateway with those of the run summary.
+func PushOpenMetrics(ctx context.Context, config PushConfig, run *RunSummary) error {
+	pushURL := fmt.Sprintf("%s/metrics/job/%s", config.URL, url.PathEscape(config.Job))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, pushURL, bytes.NewReader(run.OpenMetrics()))
+	if err != nil {
+		return errors.Wrapf(err, "creating push to %s", pushURL)
+	}
+	// the gauges render the same in the Prometheus text format, which every pushgateway accepts
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "pushing metrics to %s", pushURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("pushing metrics to %s: %s: %s", pushURL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func withClusterLabels(labels map[string]string, c *ClusterSummary) map[string]string {
+	labels["flavor"] = c.Flavor
+	labels["region"] = c.Region
+	labels["sku"] = c.SKU
+	labels["kubernetes_version"] = c.KubernetesVersion
+	return labels
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (m metricSet) add(name, help string, labels map[string]string, value float64) {
+	name = metricPrefix + invalidMetricNameChars.ReplaceAllString(name, "_")
+	if m[name] == nil {
+		m[name] = &metricFamily{help: help}
+	}
+	m[name].samples = append(m[name].samples, metricSample{labels: labels, value: value})
+}
+
+// render writes the gauges in the OpenMetrics text format, ordered by name.
+func (m metricSet) render() []byte {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for _, name := range names {
+		family := m[name]
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		if strings.HasSuffix(name, "_seconds") {
+			fmt.Fprintf(&b, "# UNIT %s seconds\n", name)
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, escapeMetricText(family.help))
+		for _, sample := range family.samples {
+			fmt.Fprintf(&b, "%s{%s} %s\n", name, renderLabels(sample.labels), strconv.FormatFloat(sample.value, 'g', -1, 64))
+		}
+	}
+	b.WriteString("# EOF\n")
+	return b.Bytes()
+}
+
+func renderLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, k, escapeMetricText(labels[k])))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func escapeMetricText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
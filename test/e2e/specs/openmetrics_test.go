@@ -0,0 +1,126 @@
+package specs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/common/expfmt"
+)
+
+func openMetricsRunSummary() *RunSummary {
+	s := &SpecSummary{Spec: "With the aks flavor", GinkgoNode: 2, Started: time.Now(), Duration: time.Hour, Passed: true, LogCollectionDuration: 90 * time.Second}
+	s.Clusters = append(s.Clusters, &ClusterSummary{Name: "knarly-e2e-aks", Flavor: "aks", KubernetesVersion: "v1.23.5", Region: "eastus", SKU: "Standard_D2s_v3", Nodes: 50, ProvisioningDuration: 8 * time.Minute})
+	w := s.startWorkload("knarly-e2e-aks", DeploymentChurnWorkload+"-1", DeploymentChurnWorkload, nil)
+	w.measured(map[string]float64{"scheduling_throughput_pods_per_second": 23.5, "pod_startup_latency_p99_seconds": 4.2})
+	w.finish(false)
+	return &RunSummary{Specs: []*SpecSummary{s}}
+}
+
+func TestOpenMetrics(t *testing.T) {
+	g := NewWithT(t)
+
+	metrics := string(openMetricsRunSummary().OpenMetrics())
+	g.Expect(metrics).To(ContainSubstring("# TYPE knarly_cluster_provisioning_duration_seconds gauge\n# UNIT knarly_cluster_provisioning_duration_seconds seconds\n"))
+	g.Expect(metrics).To(ContainSubstring(`knarly_cluster_provisioning_duration_seconds{cluster="knarly-e2e-aks",flavor="aks",ginkgo_node="2",kubernetes_version="v1.23.5",region="eastus",sku="Standard_D2s_v3",spec="With the aks flavor"} 480` + "\n"))
+	g.Expect(metrics).To(ContainSubstring(`knarly_log_collection_duration_seconds{flavor="aks",ginkgo_node="2",kubernetes_version="v1.23.5",region="eastus",sku="Standard_D2s_v3",spec="With the aks flavor"} 90` + "\n"))
+	g.Expect(metrics).To(ContainSubstring(`knarly_workload_scheduling_throughput_pods_per_second{cluster="knarly-e2e-aks",flavor="aks",ginkgo_node="2",kubernetes_version="v1.23.5",region="eastus",run="deployment-churn-1",sku="Standard_D2s_v3",spec="With the aks flavor",workload="deployment-churn"} 23.5` + "\n"))
+	g.Expect(metrics).To(ContainSubstring(`knarly_workload_passed{`))
+	g.Expect(metrics).To(HaveSuffix("# EOF\n"))
+}
+
+func TestOpenMetricsSameWorkloadTwice(t *testing.T) {
+	g := NewWithT(t)
+
+	// the azurefile-csi and azuredisk-csi runs of the same workload against the same cluster
+	run := openMetricsRunSummary()
+	s := run.Specs[0]
+	for _, id := range []string{"incremental-scale-1", "incremental-scale-2"} {
+		w := s.startWorkload("knarly-e2e-aks", id, IncrementalScaleWorkload, nil)
+		w.measured(map[string]float64{"scheduling_throughput_pods_per_second": 10})
+		w.finish(true)
+	}
+
+	families, err := (&expfmt.TextParser{}).TextToMetricFamilies(bytes.NewReader(run.OpenMetrics()))
+	g.Expect(err).NotTo(HaveOccurred())
+	// a pushgateway rejects a push with two samples of the same name and labels
+	for name, family := range families {
+		seen := map[string]bool{}
+		for _, m := range family.Metric {
+			labels := fmt.Sprint(m.GetLabel())
+			g.Expect(seen).NotTo(HaveKey(labels), "duplicate sample of %s", name)
+			seen[labels] = true
+		}
+	}
+	g.Expect(families["knarly_workload_scheduling_throughput_pods_per_second"].Metric).To(HaveLen(3))
+}
+
+func TestPushOpenMetrics(t *testing.T) {
+	g := NewWithT(t)
+
+	var method, path string
+	var pushed []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		pushed, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	t.Setenv(utils.PushgatewayURL, server.URL+"/")
+	t.Setenv(utils.PushgatewayJob, "")
+	config, err := ResolvePushConfig(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config).To(Equal(&PushConfig{URL: server.URL, Job: "knarly"}))
+
+	g.Expect(PushOpenMetrics(context.TODO(), *config, openMetricsRunSummary())).To(Succeed())
+	g.Expect(method).To(Equal(http.MethodPut))
+	g.Expect(path).To(Equal("/metrics/job/knarly"))
+	// what a pushgateway parses the push with
+	families, err := (&expfmt.TextParser{}).TextToMetricFamilies(bytes.NewReader(pushed))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(families).To(HaveKey("knarly_workload_pod_startup_latency_p99_seconds"))
+	g.Expect(families["knarly_workload_passed"].Metric[0].GetGauge().GetValue()).To(Equal(0.0))
+
+	artifactFolder := t.TempDir()
+	g.Expect(WriteOpenMetrics(artifactFolder, openMetricsRunSummary())).To(Succeed())
+	g.Expect(filepath.Join(artifactFolder, "metrics.txt")).To(BeAnExistingFile())
+}
+
+func TestPushOpenMetricsRejected(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "pushed metrics are invalid", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := PushOpenMetrics(context.TODO(), PushConfig{URL: server.URL, Job: "knarly"}, openMetricsRunSummary())
+	g.Expect(err).To(MatchError(ContainSubstring("pushed metrics are invalid")))
+}
+
+func TestResolvePushConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	t.Setenv(utils.PushgatewayURL, "")
+	config, err := ResolvePushConfig(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config).To(BeNil())
+
+	t.Setenv(utils.PushgatewayURL, "localhost:9091")
+	_, err = ResolvePushConfig(nil)
+	g.Expect(err).To(HaveOccurred())
+
+	t.Setenv(utils.PushgatewayURL, "http://localhost:9091")
+	t.Setenv(utils.PushgatewayJob, "knarly-nightly")
+	config, err = ResolvePushConfig(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Job).To(Equal("knarly-nightly"))
+}
@@ -0,0 +1,253 @@
+package specs
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// PodStartupPhaseCreateToSchedule runs from pod creation to the pod being scheduled.
+	PodStartupPhaseCreateToSchedule = "create_to_schedule"
+	// PodStartupPhaseScheduleToRun runs from the pod being scheduled to the last of its containers starting.
+	PodStartupPhaseScheduleToRun = "schedule_to_run"
+	// PodStartupPhaseRunToReady runs from the last container starting to the pod becoming Ready.
+	PodStartupPhaseRunToReady = "run_to_ready"
+	// PodStartupPhaseCreateToReady runs from pod creation to the pod becoming Ready.
+	PodStartupPhaseCreateToReady = "create_to_ready"
+)
+
+type (
+	// PodStartupResults are the pod startup latencies measured by a PodStartupTracker.
+	PodStartupResults struct {
+		// Pods is the number of pods created in the test namespaces while tracking
+		Pods int `json:"pods"`
+		// Ready is how many of those pods became Ready
+		Ready int `json:"ready"`
+		// Phases maps each PodStartupPhase, e.g. "create_to_ready", to its percentiles
+		Phases map[string]LatencyPercentiles `json:"phases"`
+	}
+
+	// PodStartupSLO declares the thresholds the pod startup latency measured by a PodStartupTracker must meet, zero
+	// values are not checked.
+	PodStartupSLO struct {
+		// MaxCreateToReadyP99 is the maximum 99th percentile time from creating a pod to it becoming Ready
+		MaxCreateToReadyP99 time.Duration
+	}
+
+	// PodStartupTracker watches pods with a shared informer and records when each pod in the test namespaces was
+	// created, scheduled, had all its containers started, and became Ready. Test namespaces are the namespaces that
+	// did not exist yet when tracking started, i.e. the ones the workload creates.
+	PodStartupTracker struct {
+		clientSet kubernetes.Interface
+		factory   informers.SharedInformerFactory
+		start     time.Time
+
+		mu      sync.Mutex
+		stopped bool
+		// existingNamespaces existed before tracking started, so their pods are not part of the workload
+		existingNamespaces map[string]bool
+		pods               map[types.UID]*podStartupRecord
+	}
+
+	podStartupRecord struct {
+		created   time.Time
+		scheduled time.Time
+		started   time.Time
+		ready     time.Time
+	}
+)
+
+// NewPodStartupTracker returns a tracker for the pods of the cluster clientSet talks to, watching them with the pod
+// informer of factory. The informers of factory run until the context passed to Start is done, so one factory can be
+// shared by all the trackers of a workload.
+func NewPodStartupTracker(clientSet kubernetes.Interface, factory informers.SharedInformerFactory) *PodStartupTracker {
+	return &PodStartupTracker{
+		clientSet:          clientSet,
+		factory:            factory,
+		existingNamespaces: map[string]bool{},
+		pods:               map[types.UID]*podStartupRecord{},
+	}
+}
+
+// Start records the existing namespaces and starts watching pods, until Stop is called or ctx is done.
+func (t *PodStartupTracker) Start(ctx context.Context) error {
+	t.start = time.Now()
+	existingNamespaces, err := listNamespaceNames(ctx, t.clientSet)
+	if err != nil {
+		return err
+	}
+	t.existingNamespaces = existingNamespaces
+
+	informer := t.factory.Core().V1().Pods().Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				t.observe(pod)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				t.observe(pod)
+			}
+		},
+	})
+	t.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return errors.New("timed out waiting for the pod informer to sync")
+	}
+	return nil
+}
+
+// Stop stops recording pods and returns the latencies of the pods observed since Start.
+func (t *PodStartupTracker) Stop() *PodStartupResults {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+
+	phases := map[string][]time.Duration{}
+	add := func(phase string, from, to time.Time) {
+		if !from.IsZero() && !to.IsZero() && !to.Before(from) {
+			phases[phase] = append(phases[phase], to.Sub(from))
+		}
+	}
+	results := &PodStartupResults{Pods: len(t.pods), Phases: map[string]LatencyPercentiles{}}
+	for _, r := range t.pods {
+		if !r.ready.IsZero() {
+			results.Ready++
+		}
+		add(PodStartupPhaseCreateToSchedule, r.created, r.scheduled)
+		add(PodStartupPhaseScheduleToRun, r.scheduled, r.started)
+		add(PodStartupPhaseRunToReady, r.started, r.ready)
+		add(PodStartupPhaseCreateToReady, r.created, r.ready)
+	}
+	for phase, durations := range phases {
+		results.Phases[phase] = latencyPercentiles(durations)
+	}
+	return results
+}
+
+// observe updates the record of pod with whatever it has reached. Every timestamp is taken from the pod itself, so
+// all phases are measured by the cluster's clocks, with a precision of seconds, rather than mixing in when the
+// informer happened to deliver an update.
+func (t *PodStartupTracker) observe(pod *corev1.Pod) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped || t.existingNamespaces[pod.Namespace] || pod.CreationTimestamp.Time.Before(t.start.Truncate(time.Second)) {
+		return
+	}
+	r, ok := t.pods[pod.UID]
+	if !ok {
+		r = &podStartupRecord{created: pod.CreationTimestamp.Time}
+		t.pods[pod.UID] = r
+	}
+	if r.scheduled.IsZero() {
+		if c := podCondition(pod, corev1.PodScheduled); c != nil && c.Status == corev1.ConditionTrue {
+			r.scheduled = c.LastTransitionTime.Time
+		}
+	}
+	if r.started.IsZero() {
+		r.started = containersStarted(pod)
+	}
+	if r.ready.IsZero() {
+		if c := podCondition(pod, corev1.PodReady); c != nil && c.Status == corev1.ConditionTrue {
+			r.ready = c.LastTransitionTime.Time
+		}
+	}
+}
+
+// ExpectPodStartupSLOs fails the current spec if the pod startup latency measured by the specs package breaches slo.
+func ExpectPodStartupSLOs(results *PodStartupResults, slo PodStartupSLO) {
+	if slo.MaxCreateToReadyP99 == 0 {
+		return
+	}
+	Expect(results).NotTo(BeNil(), "pod startup results are required to check SLOs")
+	Expect(results.Phases).To(HaveKey(PodStartupPhaseCreateToReady), "no pod was observed becoming Ready")
+	latency := results.Phases[PodStartupPhaseCreateToReady]
+	utils.Logf("measured pod startup latency is p99=%s, SLO maximum is %s", latency.Perc99, slo.MaxCreateToReadyP99)
+	Expect(latency.Perc99).To(BeNumerically("<=", slo.MaxCreateToReadyP99), "measured p99 pod startup latency is above SLO")
+}
+
+// expectSLOs checks the measured pod startup latency against the pod startup SLO of the config.
+func (c PodChurnTestConfig) expectSLOs(results *WorkloadResults) {
+	ExpectPodStartupSLOs(results.PodStartup, c.PodStartupSLO)
+}
+
+// expectSLOs checks the measured pod startup latency against the pod startup SLO of the config.
+func (c NakedPodChurnTestConfig) expectSLOs(results *WorkloadResults) {
+	ExpectPodStartupSLOs(results.PodStartup, c.PodStartupSLO)
+}
+
+// expectSLOs checks the measured pod startup latency against the pod startup SLO of the config.
+func (c StatefulSetTestConfig) expectSLOs(results *WorkloadResults) {
+	ExpectPodStartupSLOs(results.PodStartup, c.PodStartupSLO)
+}
+
+// listNamespaceNames returns the set of namespaces that exist, which trackers use to tell apart the namespaces a
+// workload creates.
+func listNamespaceNames(ctx context.Context, clientSet kubernetes.Interface) (map[string]bool, error) {
+	namespaces, err := clientSet.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing namespaces that exist before the workload")
+	}
+	names := map[string]bool{}
+	for _, ns := range namespaces.Items {
+		names[ns.Name] = true
+	}
+	return names, nil
+}
+
+func podCondition(pod *corev1.Pod, conditionType corev1.PodConditionType) *corev1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == conditionType {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// containersStarted returns when the last container of pod started, or zero if not all of them are running.
+func containersStarted(pod *corev1.Pod) time.Time {
+	if len(pod.Status.ContainerStatuses) == 0 || len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		return time.Time{}
+	}
+	var started time.Time
+	for _, s := range pod.Status.ContainerStatuses {
+		if s.State.Running == nil {
+			return time.Time{}
+		}
+		if s.State.Running.StartedAt.Time.After(started) {
+			started = s.State.Running.StartedAt.Time
+		}
+	}
+	return started
+}
+
+// latencyPercentiles returns the nearest-rank percentiles of durations.
+func latencyPercentiles(durations []time.Duration) LatencyPercentiles {
+	if len(durations) == 0 {
+		return LatencyPercentiles{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) time.Duration {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+	return LatencyPercentiles{
+		Perc50: percentile(0.5),
+		Perc90: percentile(0.9),
+		Perc99: percentile(0.99),
+	}
+}
@@ -0,0 +1,74 @@
+package specs
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodStartupTrackerObserve(t *testing.T) {
+	g := NewWithT(t)
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	clientSet := fake.NewSimpleClientset()
+	tracker := NewPodStartupTracker(clientSet, informers.NewSharedInformerFactory(clientSet, 0))
+	tracker.start = start
+	tracker.existingNamespaces["kube-system"] = true
+
+	pod := func(uid, namespace string, created time.Time) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{UID: types.UID(uid), Namespace: namespace, CreationTimestamp: metav1.NewTime(created)},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "a"}, {Name: "b"}}},
+		}
+	}
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	// pods in namespaces that already existed, or created before tracking started, are not part of the workload
+	tracker.observe(pod("system", "kube-system", at(1)))
+	tracker.observe(pod("old", "test-1", at(-10)))
+
+	p := pod("new", "test-1", at(1))
+	tracker.observe(p)
+	p.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(at(3))}}
+	p.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{Name: "a", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(at(6))}}},
+		{Name: "b", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{}}},
+	}
+	tracker.observe(p)
+	p.Status.ContainerStatuses[1].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(at(7))}}
+	p.Status.Conditions = append(p.Status.Conditions, corev1.PodCondition{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(at(8))})
+	tracker.observe(p)
+	// later updates, e.g. after a container restart, don't move timestamps that were already recorded
+	p.Status.Conditions[1].LastTransitionTime = metav1.NewTime(at(20))
+	tracker.observe(p)
+
+	tracker.observe(pod("pending", "test-1", at(2)))
+
+	results := tracker.Stop()
+	g.Expect(results.Pods).To(Equal(2))
+	g.Expect(results.Ready).To(Equal(1))
+	g.Expect(results.Phases).To(HaveLen(4))
+	g.Expect(results.Phases[PodStartupPhaseCreateToSchedule].Perc99).To(Equal(2 * time.Second))
+	g.Expect(results.Phases[PodStartupPhaseScheduleToRun].Perc99).To(Equal(4 * time.Second))
+	g.Expect(results.Phases[PodStartupPhaseRunToReady].Perc99).To(Equal(1 * time.Second))
+	g.Expect(results.Phases[PodStartupPhaseCreateToReady].Perc99).To(Equal(7 * time.Second))
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	g := NewWithT(t)
+	var durations []time.Duration
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	g.Expect(latencyPercentiles(durations)).To(Equal(LatencyPercentiles{
+		Perc50: 50 * time.Millisecond,
+		Perc90: 90 * time.Millisecond,
+		Perc99: 99 * time.Millisecond,
+	}))
+	g.Expect(latencyPercentiles(nil)).To(Equal(LatencyPercentiles{}))
+}
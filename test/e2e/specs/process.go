@@ -0,0 +1,44 @@
+package specs
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	"github.com/pkg/errors"
+)
+
+// runInProcessGroup runs cmd in its own process group until it exits or ctx is done. Once ctx is done the whole
+// group is asked to terminate, and is killed if it is still running after gracePeriod.
+func runInProcessGroup(ctx context.Context, cmd *exec.Cmd, gracePeriod time.Duration) error {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return errors.Wrapf(err, "starting %s", cmd.Path)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	utils.Logf("stopping %s (pid %d): %v", cmd.Path, cmd.Process.Pid, ctx.Err())
+	if err := terminateProcessGroup(cmd); err != nil {
+		utils.Logf("failed to terminate process group of pid %d: %v", cmd.Process.Pid, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(gracePeriod):
+		utils.Logf("%s (pid %d) still running after %s, killing it", cmd.Path, cmd.Process.Pid, gracePeriod)
+		if err := killProcessGroup(cmd); err != nil {
+			utils.Logf("failed to kill process group of pid %d: %v", cmd.Process.Pid, err)
+		}
+		<-done
+	}
+	return errors.Wrapf(ctx.Err(), "%s was stopped", cmd.Path)
+}
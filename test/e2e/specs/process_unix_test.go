@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package specs
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRunInProcessGroupStopsChildrenOnCancel(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	// the shell ignores SIGTERM, so stopping it relies on the kill after the grace period reaching the whole group
+	cmd := exec.Command("sh", "-c", "trap '' TERM; sleep 30 & wait")
+
+	start := time.Now()
+	err := runInProcessGroup(ctx, cmd, 200*time.Millisecond)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring(context.DeadlineExceeded.Error()))
+	g.Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+}
+
+func TestRunInProcessGroupReturnsExitError(t *testing.T) {
+	g := NewWithT(t)
+
+	err := runInProcessGroup(context.Background(), exec.Command("sh", "-c", "exit 3"), time.Second)
+	g.Expect(err).To(HaveOccurred())
+	exitErr, ok := err.(*exec.ExitError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(exitErr.ExitCode()).To(Equal(3))
+}
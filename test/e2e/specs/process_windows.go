@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package specs
+
+import (
+	"os/exec"
+)
+
+// Windows has no process groups we can signal, so the process itself is killed without a graceful stop.
+
+func setProcessGroup(_ *exec.Cmd) {}
+
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
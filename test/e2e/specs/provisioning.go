@@ -0,0 +1,239 @@
+package specs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	infrav1exp "sigs.k8s.io/cluster-api-provider-azure/exp/api/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterv1exp "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ProvisioningCreated is the event of an object being created.
+	ProvisioningCreated = "Created"
+	// ProvisioningFirstNodeRef is the event of a MachinePool getting the first of its nodes.
+	ProvisioningFirstNodeRef = "FirstNodeRef"
+	// ProvisioningLastNodeRef is the event of a MachinePool getting as many nodes as it has replicas.
+	ProvisioningLastNodeRef = "LastNodeRef"
+
+	// provisioningPollInterval is how often the watcher looks at the objects of the cluster, which also bounds the
+	// error of the events the objects don't record the time of, e.g. the NodeRefs of a MachinePool.
+	provisioningPollInterval = 10 * time.Second
+)
+
+type (
+	// ProvisioningEvent is an object of a cluster reaching a condition, e.g. the Cluster reaching ControlPlaneReady.
+	ProvisioningEvent struct {
+		// Kind and Name identify the object, e.g. "MachinePool" and "knarly-e2e-aks-pool0"
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+		// Event is the condition the object reached, e.g. "InfrastructureReady", or one of ProvisioningCreated,
+		// ProvisioningFirstNodeRef and ProvisioningLastNodeRef
+		Event string `json:"event"`
+		// Time is the last transition time of the condition, or when the watcher saw the event if the object doesn't
+		// record it
+		Time time.Time `json:"time"`
+		// SinceStart is the time from the start of the watch to the event
+		SinceStart time.Duration `json:"sinceStart"`
+	}
+
+	// ProvisioningTimeline are the events of a cluster being provisioned, in the order they happened.
+	ProvisioningTimeline struct {
+		Cluster string              `json:"cluster"`
+		Started time.Time           `json:"started"`
+		Events  []ProvisioningEvent `json:"events"`
+	}
+
+	// ProvisioningWatcher records when the Cluster, AzureManagedControlPlane, MachinePools and AzureManagedMachinePools
+	// of a cluster reach their conditions, by polling the management cluster until stopped.
+	ProvisioningWatcher struct {
+		client      client.Client
+		namespace   string
+		clusterName string
+		start       time.Time
+		cancel      context.CancelFunc
+		done        chan struct{}
+		stopOnce    sync.Once
+
+		mu     sync.Mutex
+		events map[string]ProvisioningEvent
+	}
+)
+
+// NewProvisioningWatcher returns a watcher of the cluster named clusterName in namespace of the management cluster c
+// talks to.
+func NewProvisioningWatcher(c client.Client, namespace, clusterName string) *ProvisioningWatcher {
+	return &ProvisioningWatcher{
+		client:      c,
+		namespace:   namespace,
+		clusterName: clusterName,
+		done:        make(chan struct{}),
+		events:      map[string]ProvisioningEvent{},
+	}
+}
+
+// Start starts polling, which runs until Stop is called or ctx is done. The cluster does not need to exist yet.
+func (w *ProvisioningWatcher) Start(ctx context.Context) {
+	w.start = time.Now()
+	ctx, w.cancel = context.WithCancel(ctx)
+	go func() {
+		defer close(w.done)
+		wait.UntilWithContext(ctx, func(ctx context.Context) {
+			if err := w.observe(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				utils.Logf("failed to observe the provisioning of cluster %s: %v", w.clusterName, err)
+			}
+		}, provisioningPollInterval)
+	}()
+}
+
+// Stop stops polling after a last look at the objects of the cluster, and returns the timeline so far.
+func (w *ProvisioningWatcher) Stop(ctx context.Context) *ProvisioningTimeline {
+	w.stopOnce.Do(func() {
+		w.cancel()
+		<-w.done
+		if err := w.observe(ctx, time.Now()); err != nil {
+			utils.Logf("failed to observe the provisioning of cluster %s: %v", w.clusterName, err)
+		}
+	})
+	return w.timeline()
+}
+
+// WriteProvisioningTimeline writes the timeline to provisioning-timeline.json among the artifacts of its cluster, and
+// logs it.
+func WriteProvisioningTimeline(artifactFolder string, timeline *ProvisioningTimeline) error {
+	for _, e := range timeline.Events {
+		utils.Logf("cluster %s provisioning: %s %s %s after %s", timeline.Cluster, e.Kind, e.Name, e.Event, e.SinceStart.Round(time.Second))
+	}
+	dir := filepath.Join(artifactFolder, "clusters", timeline.Cluster)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "creating directory %s", dir)
+	}
+	return writeJSON(filepath.Join(dir, "provisioning-timeline.json"), timeline)
+}
+
+// observe records the events of the objects of the cluster that are new since the last look.
+func (w *ProvisioningWatcher) observe(ctx context.Context, now time.Time) error {
+	cluster := &clusterv1.Cluster{}
+	if err := w.client.Get(ctx, client.ObjectKey{Namespace: w.namespace, Name: w.clusterName}, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "getting cluster %s", w.clusterName)
+	}
+	w.recordConditions("Cluster", cluster.Name, cluster.CreationTimestamp.Time, cluster.Status.Conditions, now)
+
+	if ref := cluster.Spec.ControlPlaneRef; ref != nil && ref.Kind == "AzureManagedControlPlane" {
+		controlPlane := &infrav1exp.AzureManagedControlPlane{}
+		err := w.client.Get(ctx, client.ObjectKey{Namespace: w.namespace, Name: ref.Name}, controlPlane)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "getting AzureManagedControlPlane %s", ref.Name)
+		}
+		if err == nil {
+			w.recordConditions(ref.Kind, ref.Name, controlPlane.CreationTimestamp.Time, controlPlane.Status.Conditions, now)
+			// older CAPZ versions only report the control plane status, not conditions
+			w.recordFlag(ref.Kind, ref.Name, "Initialized", controlPlane.Status.Initialized, now)
+			w.recordFlag(ref.Kind, ref.Name, string(clusterv1.ReadyCondition), controlPlane.Status.Ready, now)
+		}
+	}
+
+	machinePools := &clusterv1exp.MachinePoolList{}
+	if err := w.client.List(ctx, machinePools, client.InNamespace(w.namespace)); err != nil {
+		return errors.Wrap(err, "listing MachinePools")
+	}
+	for i := range machinePools.Items {
+		pool := &machinePools.Items[i]
+		if pool.Spec.ClusterName != w.clusterName {
+			continue
+		}
+		w.recordConditions("MachinePool", pool.Name, pool.CreationTimestamp.Time, pool.Status.Conditions, now)
+		w.recordFlag("MachinePool", pool.Name, ProvisioningFirstNodeRef, len(pool.Status.NodeRefs) > 0, now)
+		replicas := 1
+		if pool.Spec.Replicas != nil {
+			replicas = int(*pool.Spec.Replicas)
+		}
+		w.recordFlag("MachinePool", pool.Name, ProvisioningLastNodeRef, replicas > 0 && len(pool.Status.NodeRefs) >= replicas, now)
+
+		ref := pool.Spec.Template.Spec.InfrastructureRef
+		if ref.Kind != "AzureManagedMachinePool" {
+			continue
+		}
+		infraPool := &infrav1exp.AzureManagedMachinePool{}
+		if err := w.client.Get(ctx, client.ObjectKey{Namespace: w.namespace, Name: ref.Name}, infraPool); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "getting AzureManagedMachinePool %s", ref.Name)
+		}
+		w.recordConditions(ref.Kind, ref.Name, infraPool.CreationTimestamp.Time, infraPool.Status.Conditions, now)
+		w.recordFlag(ref.Kind, ref.Name, string(clusterv1.ReadyCondition), infraPool.Status.Ready, now)
+	}
+	return nil
+}
+
+// recordConditions records the creation of an object and the first time each of its conditions was seen true, at the
+// time the condition last transitioned.
+func (w *ProvisioningWatcher) recordConditions(kind, name string, created time.Time, conditions clusterv1.Conditions, now time.Time) {
+	w.record(kind, name, ProvisioningCreated, created)
+	for _, c := range conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		at := c.LastTransitionTime.Time
+		if at.IsZero() {
+			at = now
+		}
+		w.record(kind, name, string(c.Type), at)
+	}
+}
+
+// recordFlag records the first time a status flag of an object was seen true, unless a condition of the same name
+// already recorded it.
+func (w *ProvisioningWatcher) recordFlag(kind, name, event string, set bool, now time.Time) {
+	if set {
+		w.record(kind, name, event, now)
+	}
+}
+
+func (w *ProvisioningWatcher) record(kind, name, event string, at time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := kind + "/" + name + "/" + event
+	if _, ok := w.events[key]; ok {
+		return
+	}
+	w.events[key] = ProvisioningEvent{Kind: kind, Name: name, Event: event, Time: at, SinceStart: at.Sub(w.start)}
+}
+
+func (w *ProvisioningWatcher) timeline() *ProvisioningTimeline {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	timeline := &ProvisioningTimeline{Cluster: w.clusterName, Started: w.start, Events: make([]ProvisioningEvent, 0, len(w.events))}
+	for _, e := range w.events {
+		timeline.Events = append(timeline.Events, e)
+	}
+	sort.Slice(timeline.Events, func(i, j int) bool {
+		a, b := timeline.Events[i], timeline.Events[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Event < b.Event
+	})
+	return timeline
+}
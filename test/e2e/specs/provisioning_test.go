@@ -0,0 +1,98 @@
+package specs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+	infrav1exp "sigs.k8s.io/cluster-api-provider-azure/exp/api/v1beta1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	clusterv1exp "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestProvisioningWatcherObserve(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1exp.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1exp.AddToScheme(scheme)).To(Succeed())
+	ctx := context.TODO()
+	start := time.Now().Truncate(time.Second)
+	at := func(d time.Duration) metav1.Time { return metav1.NewTime(start.Add(d)) }
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: "knarly-e2e", Name: name, CreationTimestamp: at(0)}
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	w := NewProvisioningWatcher(c, "knarly-e2e", "aks")
+	w.start = start
+	// the cluster doesn't exist yet
+	g.Expect(w.observe(ctx, start)).To(Succeed())
+	g.Expect(w.timeline().Events).To(BeEmpty())
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: meta("aks"),
+		Spec:       clusterv1.ClusterSpec{ControlPlaneRef: &corev1.ObjectReference{Kind: "AzureManagedControlPlane", Name: "aks-control-plane"}},
+		Status: clusterv1.ClusterStatus{Conditions: clusterv1.Conditions{
+			{Type: clusterv1.InfrastructureReadyCondition, Status: corev1.ConditionTrue, LastTransitionTime: at(time.Minute)},
+			{Type: clusterv1.ControlPlaneReadyCondition, Status: corev1.ConditionFalse, LastTransitionTime: at(time.Minute)},
+		}},
+	}
+	controlPlane := &infrav1exp.AzureManagedControlPlane{ObjectMeta: meta("aks-control-plane")}
+	pool := &clusterv1exp.MachinePool{
+		ObjectMeta: meta("aks-pool0"),
+		Spec: clusterv1exp.MachinePoolSpec{
+			ClusterName: "aks",
+			Replicas:    pointer.Int32(2),
+			Template: clusterv1.MachineTemplateSpec{Spec: clusterv1.MachineSpec{
+				ClusterName:       "aks",
+				InfrastructureRef: corev1.ObjectReference{Kind: "AzureManagedMachinePool", Name: "aks-pool0"},
+			}},
+		},
+	}
+	otherPool := &clusterv1exp.MachinePool{ObjectMeta: meta("other-pool0"), Spec: clusterv1exp.MachinePoolSpec{ClusterName: "other"}}
+	infraPool := &infrav1exp.AzureManagedMachinePool{ObjectMeta: meta("aks-pool0")}
+	for _, o := range []client.Object{cluster, controlPlane, pool, otherPool, infraPool} {
+		g.Expect(c.Create(ctx, o)).To(Succeed())
+	}
+	g.Expect(w.observe(ctx, start.Add(2*time.Minute))).To(Succeed())
+
+	// the control plane becomes ready and the pool gets its nodes one by one
+	cluster.Status.Conditions[1] = clusterv1.Condition{Type: clusterv1.ControlPlaneReadyCondition, Status: corev1.ConditionTrue, LastTransitionTime: at(9 * time.Minute)}
+	g.Expect(c.Update(ctx, cluster)).To(Succeed())
+	controlPlane.Status.Ready = true
+	g.Expect(c.Update(ctx, controlPlane)).To(Succeed())
+	pool.Status.NodeRefs = []corev1.ObjectReference{{Name: "node-0"}}
+	g.Expect(c.Update(ctx, pool)).To(Succeed())
+	g.Expect(w.observe(ctx, start.Add(10*time.Minute))).To(Succeed())
+	pool.Status.NodeRefs = append(pool.Status.NodeRefs, corev1.ObjectReference{Name: "node-1"})
+	g.Expect(c.Update(ctx, pool)).To(Succeed())
+	infraPool.Status.Ready = true
+	g.Expect(c.Update(ctx, infraPool)).To(Succeed())
+	g.Expect(w.observe(ctx, start.Add(12*time.Minute))).To(Succeed())
+	g.Expect(w.observe(ctx, start.Add(14*time.Minute))).To(Succeed())
+
+	var events []string
+	for _, e := range w.timeline().Events {
+		events = append(events, e.Kind+" "+e.Name+" "+e.Event+" "+e.SinceStart.String())
+	}
+	g.Expect(events).To(Equal([]string{
+		"AzureManagedControlPlane aks-control-plane Created 0s",
+		"AzureManagedMachinePool aks-pool0 Created 0s",
+		"Cluster aks Created 0s",
+		"MachinePool aks-pool0 Created 0s",
+		"Cluster aks InfrastructureReady 1m0s",
+		"Cluster aks ControlPlaneReady 9m0s",
+		"AzureManagedControlPlane aks-control-plane Ready 10m0s",
+		"MachinePool aks-pool0 FirstNodeRef 10m0s",
+		"AzureManagedMachinePool aks-pool0 Ready 12m0s",
+		"MachinePool aks-pool0 LastNodeRef 12m0s",
+	}))
+}
@@ -3,13 +3,15 @@ package specs
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/azure/knarly/test/e2e/utils"
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/test/framework"
@@ -19,6 +21,14 @@ type (
 	ClusterTestInput struct {
 		BootstrapClusterProxy framework.ClusterProxy
 		Cluster               *clusterv1.Cluster
+		// ArtifactFolder is where workload reports are written, under clusters/<cluster name>
+		ArtifactFolder string
+		// ClusterLoader2 locates the clusterloader2 binary and workload configs, see ResolveClusterLoader2
+		ClusterLoader2 *ClusterLoader2
+		// Summary, when set, gets the parameters, outcome and key measurements of each workload run, see WriteSpecSummary
+		Summary *SpecSummary
+		// Events selects the events of the cluster recorded while each workload runs; the zero value records all of them
+		Events EventFilter
 	}
 
 	PodChurnTestConfig struct {
@@ -36,6 +46,45 @@ type (
 		PodChurnRate int
 		// PodsPerDeployment sets the maximum number of pod replicas in a single deployment; as more pods are needed,
 		PodsPerDeployment int
+		// ChurnFraction is the fraction of pods replaced in each churn round, only values below 1.0 need Cleanup=0 and NumChurnIterations=1; unset uses 1.0
+		ChurnFraction *float64
+		// NodeCount overrides the node count pods are sized by, e.g. to make the Cluster Autoscaler scale out; unset uses the current node count
+		NodeCount *int
+		// PodController selects whether pods are created by a 'deployment' or a 'statefulset'; empty uses 'deployment'
+		PodController string
+		// NamespacePrefix is the prefix of the namespaces clusterloader2 creates; empty uses a generated prefix
+		NamespacePrefix string
+		// TestID labels the pods created by the test; empty uses 'deployment-churn'
+		TestID string
+		// DeleteAutomanagedNamespaces deletes the test namespaces at the end of the test; unset uses true
+		DeleteAutomanagedNamespaces *bool
+		// DeleteStaleNamespaces deletes namespaces left behind by previous runs; unset uses true
+		DeleteStaleNamespaces *bool
+		// PvcStorageClass is the storage class of statefulset PVCs, see StatefulSetTestConfig; empty uses 'default'
+		PvcStorageClass string
+		// PvcStorageQuantity is the size of statefulset PVCs, e.g., '8Gi'; empty uses '8Gi'
+		PvcStorageQuantity string
+		// PodManagementPolicy of statefulsets, 'OrderedReady' or 'Parallel'; empty uses 'OrderedReady'
+		PodManagementPolicy string
+		// SLO declares the thresholds the clusterloader2 results must meet for the spec to pass
+		SLO ClusterLoader2SLO
+		// PodStartupSLO declares the thresholds the pod startup latency measured by the specs package must meet
+		PodStartupSLO PodStartupSLO
+	}
+
+	NakedPodChurnTestConfig struct {
+		// Cleanup indicates whether or not to explicitly cleanup pods after test, 0=no, 1=yes
+		Cleanup int
+		// PodStartTimeoutMins indicates how long to wait for all pods to be running
+		PodStartTimeoutMins int
+		// PodsPerNode determines how many pods to create, per node, in the cluster
+		PodsPerNode int
+		// PodChurnRate configures the desired pods to create, and delete per second
+		PodChurnRate int
+		// SLO declares the thresholds the clusterloader2 results must meet for the spec to pass
+		SLO ClusterLoader2SLO
+		// PodStartupSLO declares the thresholds the pod startup latency measured by the specs package must meet
+		PodStartupSLO PodStartupSLO
 	}
 
 	StatefulSetTestConfig struct {
@@ -45,8 +94,10 @@ type (
 		InstancesPerNamespace int
 		// TotalScaleSteps is the number of scale steps to use during a test run
 		TotalScaleSteps int
-		// PodsPerScaleStep is the number of stateful set pods to schedule per step
+		// PodsPerScaleStep is the number of stateful set pods to schedule per step; zero falls back to PodsPerScaleStepExpression
 		PodsPerScaleStep int
+		// PodsPerScaleStepExpression scales the pods per step with the cluster, e.g. '2x nodes' or 'per-node:3'; empty uses one pod per node
+		PodsPerScaleStepExpression string
 		// StepDelayMinutes is the delay in between scale steps, in minutes
 		StepDelayMinutes int
 		// PvcStorageClass declares which type of storage driver to use, valid values are 'azurefile-csi' or 'azuredisk-csi'
@@ -55,6 +106,64 @@ type (
 		PvcStorageQuantity string
 		// PodManagementPolicy; choose 'OrderedReady' for incremental statefulset scale up, 'Parallel' for complete immediate pod creation
 		PodManagementPolicy string
+		// SLO declares the thresholds the clusterloader2 results must meet for the spec to pass
+		SLO ClusterLoader2SLO
+		// PodStartupSLO declares the thresholds the pod startup latency measured by the specs package must meet
+		PodStartupSLO PodStartupSLO
+	}
+
+	ServiceChurnTestConfig struct {
+		// Namespaces indicates the number of namespaces to use for all services
+		Namespaces int
+		// ServicesPerNamespace is the number of services in each namespace, each backed by its own deployment
+		ServicesPerNamespace int
+		// PodsPerService is the number of pods behind each service
+		PodsPerService int
+		// NumChurnIterations is the number of times the pods behind every service are replaced
+		NumChurnIterations int
+		// PodChurnRate configures the desired pods to create, and delete per second
+		PodChurnRate int
+		// PodStartTimeoutMins indicates how long to wait for all pods to be running
+		PodStartTimeoutMins int
+		// Cleanup indicates whether or not to explicitly cleanup deployments and services after test, 0=no, 1=yes
+		Cleanup int
+		// SLO declares the thresholds the clusterloader2 and endpoint results must meet for the spec to pass
+		SLO ServiceChurnSLO
+		// PodStartupSLO declares the thresholds the pod startup latency measured by the specs package must meet
+		PodStartupSLO PodStartupSLO
+	}
+
+	// ServiceChurnSLO declares the thresholds the results of the service-churn workload must meet, zero values are not
+	// checked.
+	ServiceChurnSLO struct {
+		// ClusterLoader2SLO holds the thresholds the clusterloader2 results must meet
+		ClusterLoader2SLO
+		// MaxEndpointPropagationLatencyP99 is the maximum 99th percentile time for a Ready pod to show as a ready
+		// endpoint, as measured by the EndpointSliceTracker
+		MaxEndpointPropagationLatencyP99 time.Duration
+	}
+
+	// WatchFanOutTestConfig configures the watch-fanout workload, where clusterloader2 creates configmaps and secrets
+	// and the specs package updates them while many watchers observe the updates.
+	WatchFanOutTestConfig struct {
+		// Namespaces indicates the number of namespaces to create the configmaps and secrets in
+		Namespaces int
+		// NamespacePrefix overrides the prefix of the namespace names, defaults to "watch-fanout"
+		NamespacePrefix string
+		// ConfigMapsPerNamespace is the number of configmaps in each namespace
+		ConfigMapsPerNamespace int
+		// SecretsPerNamespace is the number of secrets in each namespace
+		SecretsPerNamespace int
+		// ObjectSizeBytes is the size of the data of each configmap and secret
+		ObjectSizeBytes int
+		// WatchersPerNamespace is the number of watchers of the configmaps and secrets in each namespace
+		WatchersPerNamespace int
+		// UpdateQPS is the number of updates made per second, round robin across all objects
+		UpdateQPS int
+		// UpdateDurationMins indicates how long to keep updating the objects for
+		UpdateDurationMins int
+		// SLO declares the thresholds the clusterloader2 and watch fan-out results must meet for the spec to pass
+		SLO WatchFanOutSLO
 	}
 )
 
@@ -70,59 +179,218 @@ func ListNamespaces(ctx context.Context, input ClusterTestInput) {
 	utils.Logf("namespaces in workload cluster are %+v", list.Items)
 }
 
-func RunPodChurnTest(ctx context.Context, input ClusterTestInput, testConfig PodChurnTestConfig) {
-	specName := "run-pod-churn-tests"
-	Expect(input.BootstrapClusterProxy).NotTo(BeNil(), "Invalid argument. input.BootstrapClusterProxy can't be nil when calling %s spec", specName)
-	Expect(input.Cluster).NotTo(BeNil(), "Invalid argument. input.Cluster can't be nil when calling %s spec", specName)
-	clusterProxy := input.BootstrapClusterProxy.GetWorkloadCluster(ctx, input.Cluster.Namespace, input.Cluster.Name)
-	kubeConfigPath := clusterProxy.GetKubeconfigPath()
-	ex, err := os.Executable()
-	Expect(err).ToNot(HaveOccurred())
-	cwd := filepath.Dir(ex)
-	cwdSlice := strings.Split(cwd, "/")
-	gitRootFilepath := strings.Join(cwdSlice[:len(cwdSlice)-2], "/")
-	clusterloader2Command := exec.Command("perf-tests/clusterloader2/cmd/clusterloader", fmt.Sprintf("--testconfig=%s/test/workloads/deployment-churn/config.yaml", gitRootFilepath), "--provider=aks", fmt.Sprintf("--kubeconfig=%s", kubeConfigPath), "--v=2", "--enable-exec-service=false")
-	clusterloader2Command.Env = append(os.Environ(), fmt.Sprintf("CL2_NS_COUNT=%d", testConfig.Namespaces),
-		fmt.Sprintf("CL2_CLEANUP=%d", testConfig.Cleanup),
-		fmt.Sprintf("CL2_REPEATS=%d", testConfig.NumChurnIterations),
-		fmt.Sprintf("CL2_POD_START_TIMEOUT_MINS=%d", testConfig.PodStartTimeoutMins),
-		fmt.Sprintf("CL2_PODS_PER_NODE=%d", testConfig.PodsPerNode),
-		fmt.Sprintf("CL2_TARGET_POD_CHURN=%d", testConfig.PodChurnRate),
-		fmt.Sprintf("CL2_PODS_PER_DEPLOYMENT=%d", testConfig.PodsPerDeployment))
-	clusterloader2Command.Dir = gitRootFilepath
-	fmt.Printf("clusterloader2Command: %#v\n", clusterloader2Command)
-	out, err := clusterloader2Command.CombinedOutput()
-	utils.Logf("%s\n", out)
-	Expect(err).ToNot(HaveOccurred())
+const (
+	// DeploymentChurnWorkload churns pods through deployments, see test/workloads/deployment-churn
+	DeploymentChurnWorkload = "deployment-churn"
+	// NakedPodChurnWorkload churns naked pods, see test/workloads/naked-pod-churn
+	NakedPodChurnWorkload = "naked-pod-churn"
+	// IncrementalScaleWorkload scales statefulsets up in steps, see test/workloads/incremental-scale
+	IncrementalScaleWorkload = "incremental-scale"
+	// ServiceChurnWorkload churns the pods behind services, see test/workloads/service-churn
+	ServiceChurnWorkload = "service-churn"
+	// WatchFanOutWorkload updates configmaps and secrets watched by many watchers, see test/workloads/watch-fanout
+	WatchFanOutWorkload = "watch-fanout"
+)
+
+func init() {
+	RegisterWorkload(Workload{Name: DeploymentChurnWorkload, ConfigPath: "deployment-churn/config.yaml", Timeout: 90 * time.Minute})
+	RegisterWorkload(Workload{Name: NakedPodChurnWorkload, ConfigPath: "naked-pod-churn/config.yaml", Timeout: 60 * time.Minute})
+	RegisterWorkload(Workload{Name: IncrementalScaleWorkload, ConfigPath: "incremental-scale/config.yaml", Timeout: 120 * time.Minute})
+	RegisterWorkload(Workload{Name: ServiceChurnWorkload, ConfigPath: "service-churn/config.yaml", Timeout: 60 * time.Minute})
+	RegisterWorkload(Workload{Name: WatchFanOutWorkload, ConfigPath: "watch-fanout/config.yaml", Timeout: 60 * time.Minute})
 }
 
-func RunStatefulSetTest(ctx context.Context, input ClusterTestInput, testConfig StatefulSetTestConfig) {
-	specName := "run-stateful-set-files-tests"
-	Expect(input.BootstrapClusterProxy).NotTo(BeNil(), "Invalid argument. input.BootstrapClusterProxy can't be nil when calling %s spec", specName)
-	Expect(input.Cluster).NotTo(BeNil(), "Invalid argument. input.Cluster can't be nil when calling %s spec", specName)
-	clusterProxy := input.BootstrapClusterProxy.GetWorkloadCluster(ctx, input.Cluster.Namespace, input.Cluster.Name)
-	clientSet := clusterProxy.GetClientSet()
-	nodesList, err := clientSet.CoreV1().Nodes().List(ctx, v1.ListOptions{})
-	Expect(err).ToNot(HaveOccurred())
-	numNodes := len(nodesList.Items)
-	kubeConfigPath := clusterProxy.GetKubeconfigPath()
-	ex, err := os.Executable()
-	Expect(err).ToNot(HaveOccurred())
-	cwd := filepath.Dir(ex)
-	cwdSlice := strings.Split(cwd, "/")
-	gitRootFilepath := strings.Join(cwdSlice[:len(cwdSlice)-2], "/")
-	clusterloader2Command := exec.Command("perf-tests/clusterloader2/cmd/clusterloader", fmt.Sprintf("--testconfig=%s/test/workloads/incremental-scale/config.yaml", gitRootFilepath), "--provider=aks", fmt.Sprintf("--kubeconfig=%s", kubeConfigPath), "--v=2", "--enable-exec-service=false")
-	clusterloader2Command.Env = append(os.Environ(), fmt.Sprintf("CL2_NS_COUNT=%d", testConfig.Namespaces),
-		fmt.Sprintf("CL2_INSTANCES_PER_NS=%d", testConfig.InstancesPerNamespace),
-		fmt.Sprintf("CL2_TOTAL_SCALE_STEPS=%d", testConfig.TotalScaleSteps),
-		fmt.Sprintf("CL2_PODS_PER_SCALE_STEP=%d", numNodes),
-		fmt.Sprintf("CL2_STEP_DELAY=%dm", testConfig.StepDelayMinutes),
-		fmt.Sprintf("CL2_PVC_STORAGE_CLASS=%s", testConfig.PvcStorageClass),
-		fmt.Sprintf("CL2_PVC_STORAGE_QUANTITY=%s", testConfig.PvcStorageQuantity),
-		fmt.Sprintf("CL2_POD_MANAGEMENT_POLICY=%s", testConfig.PodManagementPolicy))
-	clusterloader2Command.Dir = gitRootFilepath
-	fmt.Printf("clusterloader2Command: %#v\n", clusterloader2Command)
-	out, err := clusterloader2Command.CombinedOutput()
-	utils.Logf("%s\n", out)
-	Expect(err).ToNot(HaveOccurred())
+func (c PodChurnTestConfig) WorkloadName() string {
+	return DeploymentChurnWorkload
+}
+
+func (c PodChurnTestConfig) ClusterLoader2Params(_ context.Context, _ framework.ClusterProxy) (map[string]interface{}, error) {
+	params := map[string]interface{}{
+		"CL2_NS_COUNT":               c.Namespaces,
+		"CL2_CLEANUP":                c.Cleanup,
+		"CL2_REPEATS":                c.NumChurnIterations,
+		"CL2_POD_START_TIMEOUT_MINS": c.PodStartTimeoutMins,
+		"CL2_PODS_PER_NODE":          c.PodsPerNode,
+		"CL2_TARGET_POD_CHURN":       c.PodChurnRate,
+		"CL2_PODS_PER_DEPLOYMENT":    c.PodsPerDeployment,
+	}
+	// optional parameters are left out when unset, so the defaults in the workload config apply. A churn fraction of 1.0
+	// is left out too, it would be rendered as the integer 1 which the template can't compare to its float default.
+	if c.ChurnFraction != nil && *c.ChurnFraction != 1 {
+		params["CL2_CHURN_FRACTION"] = *c.ChurnFraction
+	}
+	if c.NodeCount != nil {
+		params["CL2_NODE_COUNT"] = *c.NodeCount
+	}
+	if c.DeleteAutomanagedNamespaces != nil {
+		params["CL2_DELETE_AUTOMANAGED_NAMESPACES"] = *c.DeleteAutomanagedNamespaces
+	}
+	if c.DeleteStaleNamespaces != nil {
+		params["CL2_DELETE_STALE_NAMESPACES"] = *c.DeleteStaleNamespaces
+	}
+	for name, value := range map[string]string{
+		"CL2_POD_CONTROLLER":        c.PodController,
+		"CL2_NS_PREFIX":             c.NamespacePrefix,
+		"CL2_TEST_ID":               c.TestID,
+		"CL2_PVC_STORAGE_CLASS":     c.PvcStorageClass,
+		"CL2_PVC_STORAGE_QUANTITY":  c.PvcStorageQuantity,
+		"CL2_POD_MANAGEMENT_POLICY": c.PodManagementPolicy,
+	} {
+		if value != "" {
+			params[name] = value
+		}
+	}
+	return params, nil
+}
+
+func (c PodChurnTestConfig) ClusterLoader2SLO() ClusterLoader2SLO {
+	return c.SLO
+}
+
+func (c NakedPodChurnTestConfig) WorkloadName() string {
+	return NakedPodChurnWorkload
+}
+
+func (c NakedPodChurnTestConfig) ClusterLoader2Params(_ context.Context, _ framework.ClusterProxy) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"CL2_CLEANUP":                c.Cleanup,
+		"CL2_POD_START_TIMEOUT_MINS": c.PodStartTimeoutMins,
+		"CL2_PODS_PER_NODE":          c.PodsPerNode,
+		"CL2_TARGET_POD_CHURN":       c.PodChurnRate,
+	}, nil
+}
+
+func (c NakedPodChurnTestConfig) ClusterLoader2SLO() ClusterLoader2SLO {
+	return c.SLO
+}
+
+func (c StatefulSetTestConfig) WorkloadName() string {
+	return IncrementalScaleWorkload
+}
+
+func (c StatefulSetTestConfig) ClusterLoader2Params(ctx context.Context, clusterProxy framework.ClusterProxy) (map[string]interface{}, error) {
+	podsPerScaleStep, err := c.resolvePodsPerScaleStep(ctx, clusterProxy)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"CL2_NS_COUNT":              c.Namespaces,
+		"CL2_INSTANCES_PER_NS":      c.InstancesPerNamespace,
+		"CL2_TOTAL_SCALE_STEPS":     c.TotalScaleSteps,
+		"CL2_PODS_PER_SCALE_STEP":   podsPerScaleStep,
+		"CL2_STEP_DELAY":            fmt.Sprintf("%dm", c.StepDelayMinutes),
+		"CL2_PVC_STORAGE_CLASS":     c.PvcStorageClass,
+		"CL2_PVC_STORAGE_QUANTITY":  c.PvcStorageQuantity,
+		"CL2_POD_MANAGEMENT_POLICY": c.PodManagementPolicy,
+	}, nil
+}
+
+func (c StatefulSetTestConfig) ClusterLoader2SLO() ClusterLoader2SLO {
+	return c.SLO
+}
+
+func (c ServiceChurnTestConfig) WorkloadName() string {
+	return ServiceChurnWorkload
+}
+
+func (c ServiceChurnTestConfig) ClusterLoader2Params(_ context.Context, _ framework.ClusterProxy) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"CL2_NS_COUNT":               c.Namespaces,
+		"CL2_SERVICES_PER_NS":        c.ServicesPerNamespace,
+		"CL2_PODS_PER_SERVICE":       c.PodsPerService,
+		"CL2_REPEATS":                c.NumChurnIterations,
+		"CL2_TARGET_POD_CHURN":       c.PodChurnRate,
+		"CL2_POD_START_TIMEOUT_MINS": c.PodStartTimeoutMins,
+		"CL2_CLEANUP":                c.Cleanup,
+	}, nil
+}
+
+func (c ServiceChurnTestConfig) ClusterLoader2SLO() ClusterLoader2SLO {
+	return c.SLO.ClusterLoader2SLO
+}
+
+func (c WatchFanOutTestConfig) WorkloadName() string {
+	return WatchFanOutWorkload
+}
+
+func (c WatchFanOutTestConfig) ClusterLoader2Params(_ context.Context, _ framework.ClusterProxy) (map[string]interface{}, error) {
+	prefix := c.NamespacePrefix
+	if prefix == "" {
+		prefix = watchFanOutTestID
+	}
+	return map[string]interface{}{
+		"CL2_NS_COUNT":          c.Namespaces,
+		"CL2_NS_PREFIX":         prefix,
+		"CL2_CONFIGMAPS_PER_NS": c.ConfigMapsPerNamespace,
+		"CL2_SECRETS_PER_NS":    c.SecretsPerNamespace,
+		"CL2_OBJECT_SIZE_BYTES": c.ObjectSizeBytes,
+		// clusterloader2 holds the objects while the specs package updates them
+		"CL2_HOLD_MINS": c.UpdateDurationMins + watchFanOutHoldMarginMins,
+		"CL2_TEST_ID":   watchFanOutTestID,
+	}, nil
+}
+
+func (c WatchFanOutTestConfig) ClusterLoader2SLO() ClusterLoader2SLO {
+	return c.SLO.ClusterLoader2SLO
+}
+
+// resolvePodsPerScaleStep returns PodsPerScaleStep when it is set, or else evaluates PodsPerScaleStepExpression against
+// the number of nodes in the workload cluster.
+func (c StatefulSetTestConfig) resolvePodsPerScaleStep(ctx context.Context, clusterProxy framework.ClusterProxy) (int, error) {
+	if c.PodsPerScaleStep > 0 {
+		utils.Logf("using %d pods per scale step", c.PodsPerScaleStep)
+		return c.PodsPerScaleStep, nil
+	}
+	podsPerNode, err := parsePodsPerNode(c.PodsPerScaleStepExpression)
+	if err != nil {
+		return 0, err
+	}
+	nodesList, err := clusterProxy.GetClientSet().CoreV1().Nodes().List(ctx, v1.ListOptions{})
+	if err != nil {
+		return 0, errors.Wrap(err, "listing workload cluster nodes")
+	}
+	podsPerScaleStep := int(math.Max(1, math.Round(podsPerNode*float64(len(nodesList.Items)))))
+	utils.Logf("resolved %q to %d pods per scale step for %d nodes", c.PodsPerScaleStepExpression, podsPerScaleStep, len(nodesList.Items))
+	return podsPerScaleStep, nil
+}
+
+// podsPerNodeExpressions match the supported forms of StatefulSetTestConfig.PodsPerScaleStepExpression.
+var podsPerNodeExpressions = []*regexp.Regexp{
+	regexp.MustCompile(`^([0-9]*\.?[0-9]+)\s*x\s*nodes?$`),
+	regexp.MustCompile(`^per-node\s*:\s*([0-9]*\.?[0-9]+)$`),
+}
+
+// parsePodsPerNode returns the number of pods per node an expression such as '2x nodes' or 'per-node:3' stands for.
+// An empty expression stands for one pod per node.
+func parsePodsPerNode(expression string) (float64, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return 1, nil
+	}
+	for _, re := range podsPerNodeExpressions {
+		if m := re.FindStringSubmatch(expression); m != nil {
+			podsPerNode, err := strconv.ParseFloat(m[1], 64)
+			if err != nil || podsPerNode <= 0 {
+				return 0, errors.Errorf("pods per node in %q must be a positive number", expression)
+			}
+			return podsPerNode, nil
+		}
+	}
+	return 0, errors.Errorf("unsupported pods per scale step expression %q, use e.g. '2x nodes' or 'per-node:3'", expression)
+}
+
+func RunPodChurnTest(ctx context.Context, input ClusterTestInput, testConfig PodChurnTestConfig) *WorkloadResults {
+	return RunWorkload(ctx, input, testConfig)
+}
+
+func RunNakedPodChurnTest(ctx context.Context, input ClusterTestInput, testConfig NakedPodChurnTestConfig) *WorkloadResults {
+	return RunWorkload(ctx, input, testConfig)
+}
+
+func RunStatefulSetTest(ctx context.Context, input ClusterTestInput, testConfig StatefulSetTestConfig) *WorkloadResults {
+	return RunWorkload(ctx, input, testConfig)
+}
+
+func RunServiceChurnTest(ctx context.Context, input ClusterTestInput, testConfig ServiceChurnTestConfig) *WorkloadResults {
+	return RunWorkload(ctx, input, testConfig)
 }
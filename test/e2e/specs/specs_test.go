@@ -0,0 +1,62 @@
+package specs
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/pointer"
+)
+
+func TestPodChurnTestConfigOmitsUnsetOptionalParams(t *testing.T) {
+	g := NewWithT(t)
+
+	params, err := PodChurnTestConfig{Namespaces: 2, Cleanup: 1}.ClusterLoader2Params(context.Background(), nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(params).To(HaveKeyWithValue("CL2_NS_COUNT", 2))
+	for _, name := range []string{"CL2_CHURN_FRACTION", "CL2_NODE_COUNT", "CL2_POD_CONTROLLER", "CL2_NS_PREFIX", "CL2_TEST_ID", "CL2_DELETE_STALE_NAMESPACES", "CL2_PVC_STORAGE_CLASS"} {
+		g.Expect(params).NotTo(HaveKey(name))
+	}
+
+	params, err = PodChurnTestConfig{
+		ChurnFraction:         pointer.Float64(0.5),
+		NodeCount:             pointer.Int(100),
+		PodController:         "statefulset",
+		DeleteStaleNamespaces: pointer.Bool(false),
+	}.ClusterLoader2Params(context.Background(), nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(params).To(HaveKeyWithValue("CL2_CHURN_FRACTION", 0.5))
+	g.Expect(params).To(HaveKeyWithValue("CL2_NODE_COUNT", 100))
+	g.Expect(params).To(HaveKeyWithValue("CL2_POD_CONTROLLER", "statefulset"))
+	g.Expect(params).To(HaveKeyWithValue("CL2_DELETE_STALE_NAMESPACES", false))
+}
+
+func TestParsePodsPerNode(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+		wantErr    bool
+	}{
+		{expression: "", want: 1},
+		{expression: "2x nodes", want: 2},
+		{expression: "1.5x nodes", want: 1.5},
+		{expression: "3xnode", want: 3},
+		{expression: "per-node:3", want: 3},
+		{expression: "per-node: 0.5", want: 0.5},
+		{expression: "per-node:0", wantErr: true},
+		{expression: "2x pods", wantErr: true},
+		{expression: "nodes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			g := NewWithT(t)
+			got, err := parsePodsPerNode(tt.expression)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
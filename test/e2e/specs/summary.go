@@ -0,0 +1,280 @@
+package specs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+)
+
+// summaryNodesDir is where each Ginkgo node writes the summaries of its specs, relative to the artifact folder, for
+// WriteRunSummary to merge.
+const summaryNodesDir = "summary"
+
+type (
+	// RunSummary is the summary of a whole e2e run, across Ginkgo nodes.
+	RunSummary struct {
+		Specs []*SpecSummary `json:"specs"`
+	}
+
+	// SpecSummary is the summary of one spec: the clusters it provisioned, the workloads it ran and how long it all took.
+	SpecSummary struct {
+		// Spec is the text of the spec
+		Spec string `json:"spec"`
+		// GinkgoNode is the parallel node the spec ran on
+		GinkgoNode int                `json:"ginkgoNode"`
+		Started    time.Time          `json:"started"`
+		Duration   time.Duration      `json:"duration"`
+		Passed     bool               `json:"passed"`
+		Clusters   []*ClusterSummary  `json:"clusters"`
+		Workloads  []*WorkloadSummary `json:"workloads"`
+		// LogCollectionDuration is how long dumping the logs and resources of the spec took
+		LogCollectionDuration time.Duration `json:"logCollectionDuration"`
+	}
+
+	// ClusterSummary describes a cluster a spec provisioned.
+	ClusterSummary struct {
+		Name              string `json:"name"`
+		Flavor            string `json:"flavor"`
+		KubernetesVersion string `json:"kubernetesVersion"`
+		// Region, SKU and Nodes are taken from the nodes of the cluster once it is provisioned, where SKU lists the
+		// distinct instance types of the nodes, e.g. "Standard_D2s_v3"
+		Region               string        `json:"region,omitempty"`
+		SKU                  string        `json:"sku,omitempty"`
+		Nodes                int           `json:"nodes,omitempty"`
+		ProvisioningDuration time.Duration `json:"provisioningDuration"`
+	}
+
+	// WorkloadSummary describes a workload a spec ran.
+	WorkloadSummary struct {
+		// ID tells the runs of a workload against a cluster apart, e.g. "incremental-scale-2", and names their artifacts
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		// Cluster is the name of the cluster the workload ran against
+		Cluster string `json:"cluster"`
+		// Params are the parameters the workload ran with, e.g. its CL2_ variables
+		Params   map[string]interface{} `json:"params"`
+		Started  time.Time              `json:"started"`
+		Duration time.Duration          `json:"duration"`
+		Passed   bool                   `json:"passed"`
+		// Measurements are the key measurements of the workload, e.g. "pod_startup_latency_p99_seconds"
+		Measurements map[string]float64 `json:"measurements,omitempty"`
+		// Regressions are the measurements that got worse than the baseline tolerates, see RecordRegressions
+		Regressions []string `json:"regressions,omitempty"`
+		// Regressed is whether any of the regressions breached a rule with RegressionFail, which keeps the run from
+		// becoming the latest baseline
+		Regressed bool `json:"regressed,omitempty"`
+	}
+)
+
+// startWorkload adds a workload to the summary of a spec and returns it, or nil if there is no summary to add to.
+func (s *SpecSummary) startWorkload(cluster, id, name string, params interface{}) *WorkloadSummary {
+	if s == nil {
+		return nil
+	}
+	w := &WorkloadSummary{ID: id, Name: name, Cluster: cluster, Params: summaryParams(params), Started: time.Now()}
+	s.Workloads = append(s.Workloads, w)
+	return w
+}
+
+// cluster returns the summary of the named cluster, or nil if the spec did not provision it.
+func (s *SpecSummary) cluster(name string) *ClusterSummary {
+	for _, c := range s.Clusters {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// measured records the key measurements of a workload, adding to those already recorded, which is done before its
+// SLOs are checked so failing workloads have them too.
+func (w *WorkloadSummary) measured(measurements map[string]float64) {
+	if w == nil {
+		return
+	}
+	if w.Measurements == nil {
+		w.Measurements = map[string]float64{}
+	}
+	for name, value := range measurements {
+		w.Measurements[name] = value
+	}
+}
+
+// finish records how long a workload took and whether it passed, and is meant to be deferred so failing workloads
+// are recorded too.
+func (w *WorkloadSummary) finish(passed bool) {
+	if w != nil {
+		w.Duration = time.Since(w.Started)
+		w.Passed = passed
+	}
+}
+
+// SummarizeClusterNodes sets the region, SKU and number of nodes of a cluster from the labels of its nodes.
+func SummarizeClusterNodes(ctx context.Context, clientSet kubernetes.Interface, cluster *ClusterSummary) error {
+	nodes, err := clientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "listing nodes of cluster %s", cluster.Name)
+	}
+	regions, skus := sets.NewString(), sets.NewString()
+	for _, node := range nodes.Items {
+		if region := node.Labels[corev1.LabelTopologyRegion]; region != "" {
+			regions.Insert(region)
+		}
+		if sku := node.Labels[corev1.LabelInstanceTypeStable]; sku != "" {
+			skus.Insert(sku)
+		}
+	}
+	cluster.Region = strings.Join(regions.List(), ",")
+	cluster.SKU = strings.Join(skus.List(), ",")
+	cluster.Nodes = len(nodes.Items)
+	return nil
+}
+
+// summaryParams renders the parameters of a workload, e.g. its CL2_ variables or its config struct, to a map.
+func summaryParams(params interface{}) map[string]interface{} {
+	if m, ok := params.(map[string]interface{}); ok {
+		return m
+	}
+	rendered := map[string]interface{}{}
+	b, err := json.Marshal(params)
+	if err == nil {
+		err = json.Unmarshal(b, &rendered)
+	}
+	if err != nil {
+		return map[string]interface{}{"params": fmt.Sprintf("%+v", params)}
+	}
+	return rendered
+}
+
+// WriteSpecSummary adds the summary of a spec to the summaries the current Ginkgo node wrote so far.
+func WriteSpecSummary(artifactFolder string, node int, summary *SpecSummary) error {
+	path := filepath.Join(artifactFolder, summaryNodesDir, fmt.Sprintf("node-%d.json", node))
+	run, err := readRunSummary(path)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+	run.Specs = append(run.Specs, summary)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "creating summary directory %s", filepath.Dir(path))
+	}
+	return writeJSON(path, run)
+}
+
+// WriteRunSummary merges the spec summaries written by all Ginkgo nodes into summary.json and summary.md in the
+// artifact folder, ordered by when each spec started.
+func WriteRunSummary(artifactFolder string) (*RunSummary, error) {
+	paths, err := filepath.Glob(filepath.Join(artifactFolder, summaryNodesDir, "node-*.json"))
+	if err != nil {
+		return nil, errors.Wrap(err, "finding spec summaries")
+	}
+	merged := &RunSummary{Specs: []*SpecSummary{}}
+	for _, path := range paths {
+		run, err := readRunSummary(path)
+		if err != nil {
+			return nil, err
+		}
+		merged.Specs = append(merged.Specs, run.Specs...)
+	}
+	sort.SliceStable(merged.Specs, func(i, j int) bool { return merged.Specs[i].Started.Before(merged.Specs[j].Started) })
+
+	if err := writeJSON(filepath.Join(artifactFolder, "summary.json"), merged); err != nil {
+		return nil, err
+	}
+	mdPath := filepath.Join(artifactFolder, "summary.md")
+	if err := ioutil.WriteFile(mdPath, []byte(merged.Markdown()), 0644); err != nil {
+		return nil, errors.Wrapf(err, "writing %s", mdPath)
+	}
+	return merged, nil
+}
+
+func readRunSummary(path string) (*RunSummary, error) {
+	run := &RunSummary{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return run, errors.Wrapf(err, "reading spec summaries %s", path)
+	}
+	if err := json.Unmarshal(b, run); err != nil {
+		return run, errors.Wrapf(err, "parsing spec summaries %s", path)
+	}
+	return run, nil
+}
+
+// Markdown renders the summary as a table of specs, followed by the clusters and workloads of each spec.
+func (r *RunSummary) Markdown() string {
+	var b bytes.Buffer
+	b.WriteString("# Run summary\n\n")
+	b.WriteString("| Spec | Ginkgo node | Outcome | Duration | Log collection |\n")
+	b.WriteString("|---|---|---|---|---|\n")
+	for _, s := range r.Specs {
+		fmt.Fprintf(&b, "| %s | %d | %s | %s | %s |\n", markdownCell(s.Spec), s.GinkgoNode, outcome(s.Passed), s.Duration.Round(time.Second), s.LogCollectionDuration.Round(time.Second))
+	}
+	for _, s := range r.Specs {
+		fmt.Fprintf(&b, "\n## %s\n", s.Spec)
+		if len(s.Clusters) > 0 {
+			b.WriteString("\n| Cluster | Flavor | Kubernetes version | Region | SKU | Nodes | Provisioning |\n")
+			b.WriteString("|---|---|---|---|---|---|---|\n")
+			for _, c := range s.Clusters {
+				fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %d | %s |\n", markdownCell(c.Name), markdownCell(c.Flavor), markdownCell(c.KubernetesVersion), markdownCell(c.Region), markdownCell(c.SKU), c.Nodes, c.ProvisioningDuration.Round(time.Second))
+			}
+		}
+		if len(s.Workloads) > 0 {
+			b.WriteString("\n| Workload | Cluster | Outcome | Duration | Parameters | Measurements |\n")
+			b.WriteString("|---|---|---|---|---|---|\n")
+			for _, w := range s.Workloads {
+				params := map[string]string{}
+				for k, v := range w.Params {
+					params[k] = fmt.Sprint(v)
+				}
+				measurements := map[string]string{}
+				for k, v := range w.Measurements {
+					measurements[k] = fmt.Sprintf("%g", v)
+				}
+				name := w.ID
+				if name == "" {
+					name = w.Name
+				}
+				result := outcome(w.Passed)
+				if w.Regressed {
+					result += ", regressed"
+				}
+				fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n", markdownCell(name), markdownCell(w.Cluster), result, w.Duration.Round(time.Second), markdownCell(joinSorted(params)), markdownCell(joinSorted(measurements)))
+			}
+		}
+	}
+	return b.String()
+}
+
+// markdownCell escapes s for a cell of a Markdown table, where a pipe would end the cell and a newline the row.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ").Replace(s)
+}
+
+func outcome(passed bool) string {
+	if passed {
+		return "passed"
+	}
+	return "failed"
+}
+
+// joinSorted renders m as comma separated key=value pairs, sorted by key.
+func joinSorted(m map[string]string) string {
+	var pairs []string
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
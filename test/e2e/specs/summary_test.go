@@ -0,0 +1,86 @@
+package specs
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWriteRunSummary(t *testing.T) {
+	g := NewWithT(t)
+	artifactFolder := t.TempDir()
+	start := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	churn := &SpecSummary{Spec: "churn", GinkgoNode: 1, Started: start.Add(time.Hour), Passed: true}
+	churn.Clusters = append(churn.Clusters, &ClusterSummary{Name: "knarly-e2e-aks", Flavor: "aks", KubernetesVersion: "v1.22.6", Region: "eastus", SKU: "Standard_D2s_v3", Nodes: 50, ProvisioningDuration: 8 * time.Minute})
+	w := churn.startWorkload("knarly-e2e-aks", DeploymentChurnWorkload+"-1", DeploymentChurnWorkload, PodChurnTestConfig{Namespaces: 2, PodChurnRate: 50})
+	w.measured(map[string]float64{"pod_startup_latency_p99_seconds": 4.2})
+	w.finish(true)
+	lifecycle := &SpecSummary{Spec: "lifecycle", GinkgoNode: 1, Started: start.Add(2 * time.Hour)}
+	multi := &SpecSummary{Spec: "multi", GinkgoNode: 2, Started: start}
+
+	g.Expect(WriteSpecSummary(artifactFolder, 1, churn)).To(Succeed())
+	g.Expect(WriteSpecSummary(artifactFolder, 1, lifecycle)).To(Succeed())
+	g.Expect(WriteSpecSummary(artifactFolder, 2, multi)).To(Succeed())
+
+	run, err := WriteRunSummary(artifactFolder)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(run.Specs).To(HaveLen(3))
+	g.Expect([]string{run.Specs[0].Spec, run.Specs[1].Spec, run.Specs[2].Spec}).To(Equal([]string{"multi", "churn", "lifecycle"}))
+	g.Expect(run.Specs[1].Workloads).To(HaveLen(1))
+	g.Expect(run.Specs[1].Workloads[0].Params).To(HaveKeyWithValue("Namespaces", BeEquivalentTo(2)))
+	g.Expect(run.Specs[1].Workloads[0].Passed).To(BeTrue())
+
+	g.Expect(filepath.Join(artifactFolder, "summary.json")).To(BeAnExistingFile())
+	md, err := ioutil.ReadFile(filepath.Join(artifactFolder, "summary.md"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(md)).To(ContainSubstring("| churn | 1 | passed |"))
+	g.Expect(string(md)).To(ContainSubstring("| lifecycle | 1 | failed |"))
+	g.Expect(string(md)).To(ContainSubstring("| knarly-e2e-aks | aks | v1.22.6 | eastus | Standard_D2s_v3 | 50 | 8m0s |"))
+	g.Expect(string(md)).To(ContainSubstring("pod_startup_latency_p99_seconds=4.2"))
+}
+
+func TestRunSummaryMarkdownEscapesCells(t *testing.T) {
+	g := NewWithT(t)
+	spec := &SpecSummary{Spec: "churn with a|b\nselector", GinkgoNode: 1, Passed: true}
+	w := spec.startWorkload("knarly-e2e-aks", "list-load-1", "list-load", map[string]interface{}{"Selector": "app in (a|b)"})
+	w.finish(true)
+
+	md := (&RunSummary{Specs: []*SpecSummary{spec}}).Markdown()
+	g.Expect(md).To(ContainSubstring(`| churn with a\|b selector | 1 | passed |`))
+	g.Expect(md).To(ContainSubstring(`| Selector=app in (a\|b) |`))
+}
+
+func TestWorkloadSummaryWithoutSpecSummary(t *testing.T) {
+	g := NewWithT(t)
+
+	var s *SpecSummary
+	w := s.startWorkload("knarly-e2e-aks", DeploymentChurnWorkload+"-1", DeploymentChurnWorkload, map[string]interface{}{"CL2_NAMESPACES": 2})
+	g.Expect(w).To(BeNil())
+	w.measured(map[string]float64{"pods_ready": 1})
+	w.finish(true)
+}
+
+func TestSummarizeClusterNodes(t *testing.T) {
+	g := NewWithT(t)
+
+	node := func(name, sku string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			corev1.LabelTopologyRegion:     "eastus",
+			corev1.LabelInstanceTypeStable: sku,
+		}}}
+	}
+	clientSet := fake.NewSimpleClientset(node("pool0-0", "Standard_D2s_v3"), node("pool1-0", "Standard_D4s_v3"), node("pool1-1", "Standard_D2s_v3"))
+	cluster := &ClusterSummary{Name: "knarly-e2e-aks"}
+	g.Expect(SummarizeClusterNodes(context.TODO(), clientSet, cluster)).To(Succeed())
+	g.Expect(cluster.Region).To(Equal("eastus"))
+	g.Expect(cluster.SKU).To(Equal("Standard_D2s_v3,Standard_D4s_v3"))
+	g.Expect(cluster.Nodes).To(Equal(3))
+}
@@ -0,0 +1,186 @@
+package specs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// defaultStorageClass and defaultStorageQuantity are the PVC defaults of the workload configs.
+	defaultStorageClass    = "default"
+	defaultStorageQuantity = "8Gi"
+)
+
+var (
+	// supportedStorageClasses are the storage classes the workload configs know how to provision PVCs with.
+	supportedStorageClasses = []string{"default", "managed-csi", "managed-csi-premium", "azuredisk-csi", "azurefile-csi", "azurefile-csi-premium"}
+	// supportedPodControllers are the kinds of controller the workload configs can create pods with.
+	supportedPodControllers = []string{"deployment", "statefulset"}
+	// supportedPodManagementPolicies are the statefulset pod management policies.
+	supportedPodManagementPolicies = []string{"OrderedReady", "Parallel"}
+	// minPremiumStorageQuantity is the smallest PVC the premium storage classes can provision.
+	minPremiumStorageQuantity = resource.MustParse("100Gi")
+)
+
+// Validate checks the config against the same rules deployment-churn/config.yaml enforces, so mistakes are caught
+// before a cluster is provisioned rather than when clusterloader2 renders the template.
+func (c PodChurnTestConfig) Validate() error {
+	var errs field.ErrorList
+	errs = append(errs, validatePositive(field.NewPath("Namespaces"), c.Namespaces)...)
+	errs = append(errs, validateCleanup(field.NewPath("Cleanup"), c.Cleanup)...)
+	errs = append(errs, validatePositive(field.NewPath("NumChurnIterations"), c.NumChurnIterations)...)
+	errs = append(errs, validatePositive(field.NewPath("PodStartTimeoutMins"), c.PodStartTimeoutMins)...)
+	errs = append(errs, validatePositive(field.NewPath("PodsPerNode"), c.PodsPerNode)...)
+	errs = append(errs, validatePositive(field.NewPath("PodChurnRate"), c.PodChurnRate)...)
+	errs = append(errs, validatePositive(field.NewPath("PodsPerDeployment"), c.PodsPerDeployment)...)
+	if c.ChurnFraction != nil {
+		fldPath := field.NewPath("ChurnFraction")
+		switch fraction := *c.ChurnFraction; {
+		case fraction <= 0 || fraction > 1:
+			errs = append(errs, field.Invalid(fldPath, fraction, "must be greater than 0 and at most 1.0"))
+		case fraction != 1 && c.Cleanup != 0:
+			errs = append(errs, field.Invalid(fldPath, fraction, "must be 1.0 when using explicit cleanup, otherwise the cleanup doesn't work"))
+		case fraction != 1 && c.NumChurnIterations != 1:
+			errs = append(errs, field.Invalid(fldPath, fraction, "must be 1.0 when using more than 1 churn iteration"))
+		}
+	}
+	if c.NodeCount != nil {
+		errs = append(errs, validatePositive(field.NewPath("NodeCount"), *c.NodeCount)...)
+	}
+	if c.PodController != "" {
+		errs = append(errs, validateOneOf(field.NewPath("PodController"), c.PodController, supportedPodControllers)...)
+	}
+	if c.PvcStorageClass != "" || c.PvcStorageQuantity != "" {
+		class, quantity := c.PvcStorageClass, c.PvcStorageQuantity
+		if class == "" {
+			class = defaultStorageClass
+		}
+		if quantity == "" {
+			quantity = defaultStorageQuantity
+		}
+		errs = append(errs, validatePVC(field.NewPath("PvcStorageClass"), class, field.NewPath("PvcStorageQuantity"), quantity)...)
+	}
+	if c.PodManagementPolicy != "" {
+		errs = append(errs, validateOneOf(field.NewPath("PodManagementPolicy"), c.PodManagementPolicy, supportedPodManagementPolicies)...)
+	}
+	return errs.ToAggregate()
+}
+
+// Validate checks the config against the rules naked-pod-churn/config.yaml relies on.
+func (c NakedPodChurnTestConfig) Validate() error {
+	var errs field.ErrorList
+	errs = append(errs, validateCleanup(field.NewPath("Cleanup"), c.Cleanup)...)
+	errs = append(errs, validatePositive(field.NewPath("PodStartTimeoutMins"), c.PodStartTimeoutMins)...)
+	errs = append(errs, validatePositive(field.NewPath("PodsPerNode"), c.PodsPerNode)...)
+	errs = append(errs, validatePositive(field.NewPath("PodChurnRate"), c.PodChurnRate)...)
+	return errs.ToAggregate()
+}
+
+// Validate checks the config against the rules incremental-scale/config.yaml and its templates rely on.
+func (c StatefulSetTestConfig) Validate() error {
+	var errs field.ErrorList
+	errs = append(errs, validatePositive(field.NewPath("Namespaces"), c.Namespaces)...)
+	errs = append(errs, validatePositive(field.NewPath("InstancesPerNamespace"), c.InstancesPerNamespace)...)
+	errs = append(errs, validatePositive(field.NewPath("TotalScaleSteps"), c.TotalScaleSteps)...)
+	if c.PodsPerScaleStep < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("PodsPerScaleStep"), c.PodsPerScaleStep, "must not be negative"))
+	}
+	if c.PodsPerScaleStepExpression != "" {
+		fldPath := field.NewPath("PodsPerScaleStepExpression")
+		if c.PodsPerScaleStep > 0 {
+			errs = append(errs, field.Forbidden(fldPath, "can't be set together with PodsPerScaleStep"))
+		} else if _, err := parsePodsPerNode(c.PodsPerScaleStepExpression); err != nil {
+			errs = append(errs, field.Invalid(fldPath, c.PodsPerScaleStepExpression, err.Error()))
+		}
+	}
+	if c.StepDelayMinutes < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("StepDelayMinutes"), c.StepDelayMinutes, "must not be negative"))
+	}
+	errs = append(errs, validatePVC(field.NewPath("PvcStorageClass"), c.PvcStorageClass, field.NewPath("PvcStorageQuantity"), c.PvcStorageQuantity)...)
+	errs = append(errs, validateOneOf(field.NewPath("PodManagementPolicy"), c.PodManagementPolicy, supportedPodManagementPolicies)...)
+	return errs.ToAggregate()
+}
+
+// Validate checks the config against the rules service-churn/config.yaml relies on.
+func (c ServiceChurnTestConfig) Validate() error {
+	var errs field.ErrorList
+	errs = append(errs, validatePositive(field.NewPath("Namespaces"), c.Namespaces)...)
+	errs = append(errs, validatePositive(field.NewPath("ServicesPerNamespace"), c.ServicesPerNamespace)...)
+	errs = append(errs, validatePositive(field.NewPath("PodsPerService"), c.PodsPerService)...)
+	errs = append(errs, validatePositive(field.NewPath("NumChurnIterations"), c.NumChurnIterations)...)
+	errs = append(errs, validatePositive(field.NewPath("PodStartTimeoutMins"), c.PodStartTimeoutMins)...)
+	errs = append(errs, validateCleanup(field.NewPath("Cleanup"), c.Cleanup)...)
+	// the churn rate is halved and divided by the pods per service into deployments per second, which must not be zero
+	if c.PodChurnRate < 2 {
+		errs = append(errs, field.Invalid(field.NewPath("PodChurnRate"), c.PodChurnRate, "must be at least 2"))
+	}
+	return errs.ToAggregate()
+}
+
+// Validate checks the config against the rules watch-fanout/config.yaml relies on, and that the updates leave
+// clusterloader2 time to finish holding the objects before the workload times out.
+func (c WatchFanOutTestConfig) Validate() error {
+	var errs field.ErrorList
+	errs = append(errs, validatePositive(field.NewPath("Namespaces"), c.Namespaces)...)
+	errs = append(errs, validatePositive(field.NewPath("ObjectSizeBytes"), c.ObjectSizeBytes)...)
+	errs = append(errs, validatePositive(field.NewPath("WatchersPerNamespace"), c.WatchersPerNamespace)...)
+	errs = append(errs, validatePositive(field.NewPath("UpdateQPS"), c.UpdateQPS)...)
+	errs = append(errs, validatePositive(field.NewPath("UpdateDurationMins"), c.UpdateDurationMins)...)
+	if c.ConfigMapsPerNamespace < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("ConfigMapsPerNamespace"), c.ConfigMapsPerNamespace, "must not be negative"))
+	}
+	if c.SecretsPerNamespace < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("SecretsPerNamespace"), c.SecretsPerNamespace, "must not be negative"))
+	}
+	if c.ConfigMapsPerNamespace+c.SecretsPerNamespace <= 0 {
+		errs = append(errs, field.Required(field.NewPath("ConfigMapsPerNamespace"), "at least one configmap or secret per namespace is required"))
+	}
+	// clusterloader2 holds the objects for longer than the updates, and must finish doing so before it times out
+	if timeout := workloads[WatchFanOutWorkload].Timeout; timeout > 0 && time.Duration(c.UpdateDurationMins+watchFanOutHoldMarginMins)*time.Minute >= timeout {
+		errs = append(errs, field.Invalid(field.NewPath("UpdateDurationMins"), c.UpdateDurationMins,
+			fmt.Sprintf("must leave clusterloader2 %d more minutes to hold the objects for within the workload timeout of %s", watchFanOutHoldMarginMins, timeout)))
+	}
+	return errs.ToAggregate()
+}
+
+func validatePositive(fldPath *field.Path, value int) field.ErrorList {
+	if value <= 0 {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be greater than zero")}
+	}
+	return nil
+}
+
+func validateCleanup(fldPath *field.Path, value int) field.ErrorList {
+	if value != 0 && value != 1 {
+		return field.ErrorList{field.Invalid(fldPath, value, "must be 0 (no explicit cleanup) or 1 (explicit cleanup)")}
+	}
+	return nil
+}
+
+func validateOneOf(fldPath *field.Path, value string, supported []string) field.ErrorList {
+	for _, s := range supported {
+		if value == s {
+			return nil
+		}
+	}
+	return field.ErrorList{field.NotSupported(fldPath, value, supported)}
+}
+
+func validatePVC(classPath *field.Path, class string, quantityPath *field.Path, quantity string) field.ErrorList {
+	errs := validateOneOf(classPath, class, supportedStorageClasses)
+	q, err := resource.ParseQuantity(quantity)
+	if err != nil {
+		return append(errs, field.Invalid(quantityPath, quantity, err.Error()))
+	}
+	if q.Sign() <= 0 {
+		errs = append(errs, field.Invalid(quantityPath, quantity, "must be greater than zero"))
+	}
+	if strings.HasSuffix(class, "-premium") && q.Cmp(minPremiumStorageQuantity) < 0 {
+		errs = append(errs, field.Invalid(quantityPath, quantity, "must be at least "+minPremiumStorageQuantity.String()+" for premium storage classes"))
+	}
+	return errs
+}
@@ -0,0 +1,151 @@
+package specs
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/pointer"
+)
+
+func TestPodChurnTestConfigValidate(t *testing.T) {
+	valid := PodChurnTestConfig{
+		Namespaces:          2,
+		Cleanup:             1,
+		NumChurnIterations:  4,
+		PodStartTimeoutMins: 25,
+		PodsPerNode:         10,
+		PodChurnRate:        50,
+		PodsPerDeployment:   32,
+	}
+
+	mutated := func(mutate func(c *PodChurnTestConfig)) PodChurnTestConfig {
+		c := valid
+		mutate(&c)
+		return c
+	}
+	runValidateTests(t, []validateTest{
+		{name: "valid", config: valid},
+		{name: "zero namespaces", config: mutated(func(c *PodChurnTestConfig) { c.Namespaces = 0 }), wantErr: "Namespaces"},
+		{name: "unsupported cleanup", config: mutated(func(c *PodChurnTestConfig) { c.Cleanup = 2 }), wantErr: "Cleanup"},
+		{name: "negative churn rate", config: mutated(func(c *PodChurnTestConfig) { c.PodChurnRate = -1 }), wantErr: "PodChurnRate"},
+		{name: "churn fraction with cleanup", config: mutated(func(c *PodChurnTestConfig) { c.ChurnFraction = pointer.Float64(0.5) }), wantErr: "explicit cleanup"},
+		{name: "churn fraction with repeats", config: mutated(func(c *PodChurnTestConfig) {
+			c.Cleanup = 0
+			c.ChurnFraction = pointer.Float64(0.5)
+		}), wantErr: "more than 1 churn iteration"},
+		{name: "churn fraction without cleanup or repeats", config: mutated(func(c *PodChurnTestConfig) {
+			c.Cleanup = 0
+			c.NumChurnIterations = 1
+			c.ChurnFraction = pointer.Float64(0.5)
+		})},
+		{name: "unsupported pod controller", config: mutated(func(c *PodChurnTestConfig) { c.PodController = "daemonset" }), wantErr: "PodController"},
+		{name: "premium class with default quantity", config: mutated(func(c *PodChurnTestConfig) {
+			c.PodController = "statefulset"
+			c.PvcStorageClass = "managed-csi-premium"
+		}), wantErr: "at least 100Gi"},
+	})
+}
+
+func TestStatefulSetTestConfigValidate(t *testing.T) {
+	valid := StatefulSetTestConfig{
+		Namespaces:            1,
+		InstancesPerNamespace: 5,
+		TotalScaleSteps:       4,
+		StepDelayMinutes:      10,
+		PvcStorageClass:       "azurefile-csi",
+		PvcStorageQuantity:    "8Gi",
+		PodManagementPolicy:   "Parallel",
+	}
+
+	mutated := func(mutate func(c *StatefulSetTestConfig)) StatefulSetTestConfig {
+		c := valid
+		mutate(&c)
+		return c
+	}
+	runValidateTests(t, []validateTest{
+		{name: "valid", config: valid},
+		{name: "unsupported storage class", config: mutated(func(c *StatefulSetTestConfig) { c.PvcStorageClass = "azurefile" }), wantErr: "PvcStorageClass"},
+		{name: "unparseable quantity", config: mutated(func(c *StatefulSetTestConfig) { c.PvcStorageQuantity = "eight" }), wantErr: "PvcStorageQuantity"},
+		{name: "premium class too small", config: mutated(func(c *StatefulSetTestConfig) { c.PvcStorageClass = "azurefile-csi-premium" }), wantErr: "at least 100Gi"},
+		{name: "premium class large enough", config: mutated(func(c *StatefulSetTestConfig) {
+			c.PvcStorageClass = "managed-csi-premium"
+			c.PvcStorageQuantity = "128Gi"
+		})},
+		{name: "unsupported pod management policy", config: mutated(func(c *StatefulSetTestConfig) { c.PodManagementPolicy = "Ordered" }), wantErr: "PodManagementPolicy"},
+		{name: "zero scale steps", config: mutated(func(c *StatefulSetTestConfig) { c.TotalScaleSteps = 0 }), wantErr: "TotalScaleSteps"},
+	})
+}
+
+func TestServiceChurnTestConfigValidate(t *testing.T) {
+	valid := ServiceChurnTestConfig{
+		Namespaces:           1,
+		ServicesPerNamespace: 10,
+		PodsPerService:       10,
+		NumChurnIterations:   2,
+		PodChurnRate:         20,
+		PodStartTimeoutMins:  5,
+		Cleanup:              1,
+	}
+
+	mutated := func(mutate func(c *ServiceChurnTestConfig)) ServiceChurnTestConfig {
+		c := valid
+		mutate(&c)
+		return c
+	}
+	runValidateTests(t, []validateTest{
+		{name: "valid", config: valid},
+		{name: "zero services", config: mutated(func(c *ServiceChurnTestConfig) { c.ServicesPerNamespace = 0 }), wantErr: "ServicesPerNamespace"},
+		{name: "churn rate too low", config: mutated(func(c *ServiceChurnTestConfig) { c.PodChurnRate = 1 }), wantErr: "PodChurnRate"},
+	})
+}
+
+func TestWatchFanOutTestConfigValidate(t *testing.T) {
+	valid := WatchFanOutTestConfig{
+		Namespaces:             2,
+		ConfigMapsPerNamespace: 10,
+		SecretsPerNamespace:    10,
+		ObjectSizeBytes:        1024,
+		WatchersPerNamespace:   20,
+		UpdateQPS:              10,
+		UpdateDurationMins:     5,
+	}
+
+	mutated := func(mutate func(c *WatchFanOutTestConfig)) WatchFanOutTestConfig {
+		c := valid
+		mutate(&c)
+		return c
+	}
+	runValidateTests(t, []validateTest{
+		{name: "valid", config: valid},
+		{name: "configmaps only", config: mutated(func(c *WatchFanOutTestConfig) { c.SecretsPerNamespace = 0 })},
+		{name: "no objects", config: mutated(func(c *WatchFanOutTestConfig) { c.ConfigMapsPerNamespace, c.SecretsPerNamespace = 0, 0 }), wantErr: "at least one configmap or secret"},
+		{name: "negative secrets", config: mutated(func(c *WatchFanOutTestConfig) { c.SecretsPerNamespace = -1 }), wantErr: "SecretsPerNamespace"},
+		{name: "no watchers", config: mutated(func(c *WatchFanOutTestConfig) { c.WatchersPerNamespace = 0 }), wantErr: "WatchersPerNamespace"},
+		{name: "zero qps", config: mutated(func(c *WatchFanOutTestConfig) { c.UpdateQPS = 0 }), wantErr: "UpdateQPS"},
+		{name: "updates outlast the timeout", config: mutated(func(c *WatchFanOutTestConfig) { c.UpdateDurationMins = 55 }), wantErr: "UpdateDurationMins"},
+	})
+}
+
+// validateTest is a case of a table-driven Validate test.
+type validateTest struct {
+	name    string
+	config  interface{ Validate() error }
+	wantErr string
+}
+
+// runValidateTests runs each test as a subtest, expecting Validate to succeed when wantErr is empty, and otherwise to
+// fail with an error that contains it.
+func runValidateTests(t *testing.T, tests []validateTest) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(HaveOccurred())
+			g.Expect(err.Error()).To(ContainSubstring(tt.wantErr))
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package specs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// The volume phases are measured with the clock of the tracker, from when it first observes a PVC, as neither PVCs nor
+// VolumeAttachments record when they got bound or attached, and mixing in the clock of the API server would shift
+// every latency by the skew between the two.
+const (
+	// VolumePhaseTimeToBound runs from PVC creation to the PVC being observed Bound.
+	VolumePhaseTimeToBound = "time_to_bound"
+	// VolumePhaseTimeToAttach runs from PVC creation to its volume being observed attached to a node. Only volumes with
+	// an attaching CSI driver, e.g. azuredisk-csi but not azurefile-csi, get there.
+	VolumePhaseTimeToAttach = "time_to_attach"
+	// VolumePhaseTimeToPodRunning runs from PVC creation to the first pod using it being observed Running.
+	VolumePhaseTimeToPodRunning = "time_to_pod_running"
+
+	// unknownStorageClass is what failures are counted against when they can't be traced back to a PVC.
+	unknownStorageClass = "unknown"
+)
+
+// volumeFailureReasons are the reasons of the events that count as volume failures.
+var volumeFailureReasons = map[string]bool{
+	"ProvisioningFailed":  true,
+	"FailedBinding":       true,
+	"FailedAttachVolume":  true,
+	"FailedMount":         true,
+	"FailedMapVolume":     true,
+	"VolumeResizeFailed":  true,
+	"FailedDetachVolume":  true,
+	"FailedUnMount":       true,
+	"FailedUnmountDevice": true,
+}
+
+type (
+	// VolumeResults are the PVC lifecycle latencies and failures measured by a VolumeTracker, by storage class.
+	VolumeResults struct {
+		StorageClasses map[string]*StorageClassVolumeResults `json:"storageClasses"`
+	}
+
+	// StorageClassVolumeResults are the PVC lifecycle latencies and failures of one storage class.
+	StorageClassVolumeResults struct {
+		// PVCs is the number of PVCs created in the test namespaces while tracking
+		PVCs int `json:"pvcs"`
+		// Bound, Attached and Running count the PVCs that got through each phase
+		Bound    int `json:"bound"`
+		Attached int `json:"attached"`
+		Running  int `json:"running"`
+		// Phases maps each VolumePhase, e.g. "time_to_bound", to its percentiles
+		Phases map[string]LatencyPercentiles `json:"phases"`
+		// Dropped counts the phases observed ending before their PVC was observed created, which the informers of
+		// different resources racing each other can cause, and which are left out of Phases
+		Dropped int `json:"dropped,omitempty"`
+		// Failures counts volume failure events, e.g. FailedAttachVolume or FailedMount, by reason
+		Failures map[string]int `json:"failures,omitempty"`
+	}
+
+	// VolumeTracker watches PersistentVolumeClaims, VolumeAttachments, pods and events in the test namespaces, i.e. the
+	// namespaces that did not exist yet when tracking started, and records how long each PVC took to be bound, attached
+	// and used by a running pod.
+	VolumeTracker struct {
+		clientSet kubernetes.Interface
+		factory   informers.SharedInformerFactory
+		start     time.Time
+
+		mu                 sync.Mutex
+		stopped            bool
+		existingNamespaces map[string]bool
+		// claims are keyed by namespace/name
+		claims map[string]*volumeClaimRecord
+		// volumeClaims maps the name of each bound PV to the key of its claim
+		volumeClaims map[string]string
+		// attachedVolumes maps the name of each PV to when it was first observed attached
+		attachedVolumes map[string]time.Time
+		// podClaims maps the namespace/name of each pod to the keys of the claims it uses
+		podClaims map[string][]string
+		// eventCounts holds the count of each failure event already accounted for
+		eventCounts map[types.UID]int32
+		// failures counts failure events by storage class and reason
+		failures map[string]map[string]int
+	}
+
+	volumeClaimRecord struct {
+		storageClass string
+		// created is when the tracker first observed the PVC, all other times are observed too
+		created  time.Time
+		bound    time.Time
+		attached time.Time
+		running  time.Time
+	}
+)
+
+// NewVolumeTracker returns a tracker for the volumes of the cluster clientSet talks to, watching them with the
+// informers of factory, see NewPodStartupTracker.
+func NewVolumeTracker(clientSet kubernetes.Interface, factory informers.SharedInformerFactory) *VolumeTracker {
+	return &VolumeTracker{
+		clientSet:       clientSet,
+		factory:         factory,
+		claims:          map[string]*volumeClaimRecord{},
+		volumeClaims:    map[string]string{},
+		attachedVolumes: map[string]time.Time{},
+		podClaims:       map[string][]string{},
+		eventCounts:     map[types.UID]int32{},
+		failures:        map[string]map[string]int{},
+	}
+}
+
+// Start records the existing namespaces and starts watching, until Stop is called or ctx is done.
+func (t *VolumeTracker) Start(ctx context.Context) error {
+	t.start = time.Now()
+	existingNamespaces, err := listNamespaceNames(ctx, t.clientSet)
+	if err != nil {
+		return err
+	}
+	t.existingNamespaces = existingNamespaces
+
+	var synced []cache.InformerSynced
+	for _, informer := range []cache.SharedIndexInformer{
+		t.factory.Core().V1().PersistentVolumeClaims().Informer(),
+		t.factory.Storage().V1().VolumeAttachments().Informer(),
+		t.factory.Core().V1().Pods().Informer(),
+		t.factory.Core().V1().Events().Informer(),
+	} {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { t.observeObject(obj, time.Now()) },
+			UpdateFunc: func(_, obj interface{}) { t.observeObject(obj, time.Now()) },
+		})
+		synced = append(synced, informer.HasSynced)
+	}
+	t.factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return errors.New("timed out waiting for the volume informers to sync")
+	}
+	return nil
+}
+
+// Stop stops recording and returns the latencies and failures observed since Start.
+func (t *VolumeTracker) Stop() *VolumeResults {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+
+	results := &VolumeResults{StorageClasses: map[string]*StorageClassVolumeResults{}}
+	classResults := func(class string) *StorageClassVolumeResults {
+		r, ok := results.StorageClasses[class]
+		if !ok {
+			r = &StorageClassVolumeResults{Phases: map[string]LatencyPercentiles{}, Failures: map[string]int{}}
+			results.StorageClasses[class] = r
+		}
+		return r
+	}
+	phases := map[string]map[string][]time.Duration{}
+	add := func(class, phase string, r *volumeClaimRecord, to time.Time) bool {
+		if to.IsZero() {
+			return false
+		}
+		if to.Before(r.created) {
+			classResults(class).Dropped++
+			return false
+		}
+		if phases[class] == nil {
+			phases[class] = map[string][]time.Duration{}
+		}
+		phases[class][phase] = append(phases[class][phase], to.Sub(r.created))
+		return true
+	}
+	for _, r := range t.claims {
+		c := classResults(r.storageClass)
+		c.PVCs++
+		if add(r.storageClass, VolumePhaseTimeToBound, r, r.bound) {
+			c.Bound++
+		}
+		if add(r.storageClass, VolumePhaseTimeToAttach, r, r.attached) {
+			c.Attached++
+		}
+		if add(r.storageClass, VolumePhaseTimeToPodRunning, r, r.running) {
+			c.Running++
+		}
+	}
+	for class, byPhase := range phases {
+		for phase, durations := range byPhase {
+			results.StorageClasses[class].Phases[phase] = latencyPercentiles(durations)
+		}
+	}
+	for class, reasons := range t.failures {
+		for reason, count := range reasons {
+			classResults(class).Failures[reason] += count
+		}
+	}
+	return results
+}
+
+func (t *VolumeTracker) observeObject(obj interface{}, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	switch o := obj.(type) {
+	case *corev1.PersistentVolumeClaim:
+		t.observeClaim(o, now)
+	case *storagev1.VolumeAttachment:
+		t.observeAttachment(o, now)
+	case *corev1.Pod:
+		t.observePod(o, now)
+	case *corev1.Event:
+		t.observeEvent(o)
+	}
+}
+
+func (t *VolumeTracker) observeClaim(pvc *corev1.PersistentVolumeClaim, now time.Time) {
+	if t.existingNamespaces[pvc.Namespace] || pvc.CreationTimestamp.Time.Before(t.start.Truncate(time.Second)) {
+		return
+	}
+	key := pvc.Namespace + "/" + pvc.Name
+	r, ok := t.claims[key]
+	if !ok {
+		r = &volumeClaimRecord{storageClass: defaultStorageClass, created: now}
+		if pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != "" {
+			r.storageClass = *pvc.Spec.StorageClassName
+		}
+		t.claims[key] = r
+	}
+	if r.bound.IsZero() && pvc.Status.Phase == corev1.ClaimBound {
+		r.bound = now
+	}
+	if pvc.Spec.VolumeName != "" {
+		t.volumeClaims[pvc.Spec.VolumeName] = key
+		// the volume may have been attached before the claim was observed bound
+		if attached, ok := t.attachedVolumes[pvc.Spec.VolumeName]; ok && r.attached.IsZero() {
+			r.attached = attached
+		}
+	}
+}
+
+func (t *VolumeTracker) observeAttachment(va *storagev1.VolumeAttachment, now time.Time) {
+	pv := va.Spec.Source.PersistentVolumeName
+	if pv == nil || !va.Status.Attached {
+		return
+	}
+	if _, ok := t.attachedVolumes[*pv]; !ok {
+		t.attachedVolumes[*pv] = now
+	}
+	if r, ok := t.claims[t.volumeClaims[*pv]]; ok && r.attached.IsZero() {
+		r.attached = t.attachedVolumes[*pv]
+	}
+}
+
+func (t *VolumeTracker) observePod(pod *corev1.Pod, now time.Time) {
+	if t.existingNamespaces[pod.Namespace] {
+		return
+	}
+	var claims []string
+	for _, v := range pod.Spec.Volumes {
+		if v.PersistentVolumeClaim != nil {
+			claims = append(claims, pod.Namespace+"/"+v.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	if len(claims) == 0 {
+		return
+	}
+	t.podClaims[pod.Namespace+"/"+pod.Name] = claims
+	if pod.Status.Phase != corev1.PodRunning {
+		return
+	}
+	for _, key := range claims {
+		if r, ok := t.claims[key]; ok && r.running.IsZero() {
+			r.running = now
+		}
+	}
+}
+
+// observeEvent counts failure events against the storage class of the PVC they are about, or of the first PVC of
+// the pod they are about. Repeats of an event only count the increase of its count.
+func (t *VolumeTracker) observeEvent(event *corev1.Event) {
+	if t.existingNamespaces[event.Namespace] || !volumeFailureReasons[event.Reason] {
+		return
+	}
+	count := event.Count
+	if count < 1 {
+		count = 1
+	}
+	delta := int(count - t.eventCounts[event.UID])
+	if delta <= 0 {
+		return
+	}
+	t.eventCounts[event.UID] = count
+
+	class := unknownStorageClass
+	involved := event.InvolvedObject.Namespace + "/" + event.InvolvedObject.Name
+	switch event.InvolvedObject.Kind {
+	case "PersistentVolumeClaim":
+		if r, ok := t.claims[involved]; ok {
+			class = r.storageClass
+		}
+	case "Pod":
+		if claims := t.podClaims[involved]; len(claims) > 0 {
+			if r, ok := t.claims[claims[0]]; ok {
+				class = r.storageClass
+			}
+		}
+	}
+	if t.failures[class] == nil {
+		t.failures[class] = map[string]int{}
+	}
+	t.failures[class][event.Reason] += delta
+}
+
+// logVolumeResults logs a line per storage class, so failures show up next to the run that caused them.
+func logVolumeResults(workload string, results *VolumeResults) {
+	for class, r := range results.StorageClasses {
+		utils.Logf("workload %q %s PVCs: %d created, %d bound, %d attached, %d used by running pods, latencies by phase are %+v, failures are %v",
+			workload, class, r.PVCs, r.Bound, r.Attached, r.Running, r.Phases, r.Failures)
+		if r.Dropped > 0 {
+			utils.Logf("workload %q %s PVCs: %d phases were observed ending before their PVC was observed created and are not counted", workload, class, r.Dropped)
+		}
+	}
+}
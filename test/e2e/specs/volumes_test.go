@@ -0,0 +1,97 @@
+package specs
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+)
+
+func TestVolumeTracker(t *testing.T) {
+	g := NewWithT(t)
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	clientSet := fake.NewSimpleClientset()
+	tracker := NewVolumeTracker(clientSet, informers.NewSharedInformerFactory(clientSet, 0))
+	tracker.start = start
+	tracker.existingNamespaces = map[string]bool{"kube-system": true}
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	claim := func(name, class string) *corev1.PersistentVolumeClaim {
+		return &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test-1", Name: name, CreationTimestamp: metav1.NewTime(at(1))},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: pointer.String(class)},
+		}
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test-1", Name: "ss-0"},
+		Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+			VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data-ss-0"}},
+		}}},
+	}
+
+	disk := claim("data-ss-0", "managed-csi")
+	tracker.observeObject(disk, at(1))
+	tracker.observeObject(pod, at(1))
+	disk.Spec.VolumeName = "pv-disk"
+	disk.Status.Phase = corev1.ClaimBound
+	tracker.observeObject(disk, at(4))
+	// the same event is seen again with its count bumped, only the increase counts
+	event := &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "test-1", Name: "ss-0.1", UID: "event-1"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "test-1", Name: "ss-0"},
+		Reason:         "FailedAttachVolume",
+		Count:          1,
+	}
+	tracker.observeObject(event, at(5))
+	event.Count = 3
+	tracker.observeObject(event, at(7))
+	tracker.observeObject(&storagev1.VolumeAttachment{
+		Spec:   storagev1.VolumeAttachmentSpec{Source: storagev1.VolumeAttachmentSource{PersistentVolumeName: pointer.String("pv-disk")}},
+		Status: storagev1.VolumeAttachmentStatus{Attached: true},
+	}, at(10))
+	pod.Status.Phase = corev1.PodRunning
+	tracker.observeObject(pod, at(12))
+
+	tracker.observeObject(claim("data-other", "azurefile-csi"), at(1))
+	// the attachment of a volume is observed before its claim
+	tracker.observeObject(&storagev1.VolumeAttachment{
+		Spec:   storagev1.VolumeAttachmentSpec{Source: storagev1.VolumeAttachmentSource{PersistentVolumeName: pointer.String("pv-late")}},
+		Status: storagev1.VolumeAttachmentStatus{Attached: true},
+	}, at(3))
+	late := claim("data-late", "azurefile-csi")
+	late.Spec.VolumeName = "pv-late"
+	tracker.observeObject(late, at(5))
+	tracker.observeObject(&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "ignored"}}, at(1))
+	tracker.observeObject(&corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "test-1", Name: "other.1", UID: "event-2"},
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "test-1", Name: "unknown"},
+		Reason:         "FailedMount",
+	}, at(2))
+
+	results := tracker.Stop()
+	g.Expect(results.StorageClasses).To(HaveLen(3))
+
+	disks := results.StorageClasses["managed-csi"]
+	g.Expect(disks.PVCs).To(Equal(1))
+	g.Expect(disks.Bound).To(Equal(1))
+	g.Expect(disks.Attached).To(Equal(1))
+	g.Expect(disks.Running).To(Equal(1))
+	g.Expect(disks.Phases[VolumePhaseTimeToBound].Perc50).To(Equal(3 * time.Second))
+	g.Expect(disks.Phases[VolumePhaseTimeToAttach].Perc50).To(Equal(9 * time.Second))
+	g.Expect(disks.Phases[VolumePhaseTimeToPodRunning].Perc50).To(Equal(11 * time.Second))
+	g.Expect(disks.Failures).To(Equal(map[string]int{"FailedAttachVolume": 3}))
+
+	files := results.StorageClasses["azurefile-csi"]
+	g.Expect(files.PVCs).To(Equal(2))
+	g.Expect(files.Bound).To(BeZero())
+	g.Expect(files.Phases).To(BeEmpty())
+	g.Expect(files.Dropped).To(Equal(1))
+
+	g.Expect(results.StorageClasses[unknownStorageClass].Failures).To(Equal(map[string]int{"FailedMount": 1}))
+}
@@ -0,0 +1,311 @@
+package specs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+	"sigs.k8s.io/cluster-api/test/framework"
+)
+
+const (
+	// watchFanOutUpdatedAtAnnotation holds the time an object was updated at, for watchers to measure their delay from.
+	watchFanOutUpdatedAtAnnotation = "knarly.azure.com/updated-at"
+	// watchFanOutTestID labels the objects of the watch-fanout workload, and is its default namespace prefix.
+	watchFanOutTestID = "watch-fanout"
+	// watchFanOutObjectsTimeout bounds how long to wait for clusterloader2 to create the objects.
+	watchFanOutObjectsTimeout = 10 * time.Minute
+	// watchFanOutHoldMarginMins is how much longer than the updates clusterloader2 holds the objects for, to allow for
+	// creating them and for the last updates to be delivered.
+	watchFanOutHoldMarginMins = 5
+	// watchFanOutDrainTimeout bounds how long to wait after the last update for watchers to catch up.
+	watchFanOutDrainTimeout = 30 * time.Second
+)
+
+type (
+	// WatchFanOutResults are the watch delivery delays measured while running the watch-fanout workload.
+	WatchFanOutResults struct {
+		// Updates is the number of configmap and secret updates made
+		Updates int `json:"updates"`
+		// Watchers is the total number of watchers, across namespaces
+		Watchers int `json:"watchers"`
+		// Expected is the number of update events the watchers should have observed between them
+		Expected int `json:"expected"`
+		// Delivered is the number of update events the watchers observed
+		Delivered int `json:"delivered"`
+		// Missed is the number of updates that found their object already deleted by clusterloader2, which are not
+		// counted in Updates
+		Missed int `json:"missed"`
+		// Delay holds the percentiles of the time from an update being made to a watcher observing it
+		Delay LatencyPercentiles `json:"delay"`
+	}
+
+	// WatchFanOutSLO declares the thresholds the results of the watch-fanout workload must meet, zero values are not
+	// checked.
+	WatchFanOutSLO struct {
+		// ClusterLoader2SLO holds the thresholds the clusterloader2 results must meet
+		ClusterLoader2SLO
+		// MaxWatchDelayP99 is the maximum 99th percentile time for an update to reach a watcher
+		MaxWatchDelayP99 time.Duration
+		// MinDeliveredRatio is the minimum fraction of the expected update events the watchers must observe, e.g. 0.99
+		MinDeliveredRatio float64
+	}
+
+	// watchFanOut runs the watchers and updates of the watch-fanout workload.
+	watchFanOut struct {
+		clientSet kubernetes.Interface
+		config    WatchFanOutTestConfig
+		selector  string
+
+		mu        sync.Mutex
+		delays    []time.Duration
+		delivered int
+	}
+
+	// watchFanOutObject is a configmap or secret to update.
+	watchFanOutObject struct {
+		namespace string
+		name      string
+		secret    bool
+	}
+)
+
+// RunWatchFanOutTest runs the watch-fanout workload, updating and watching its objects from the specs package while
+// clusterloader2 holds them, and fails the spec if the watch delivery delay breaches the SLO.
+func RunWatchFanOutTest(ctx context.Context, input ClusterTestInput, testConfig WatchFanOutTestConfig) *WorkloadResults {
+	return runWorkload(ctx, input, testConfig, func(ctx context.Context, clusterProxy framework.ClusterProxy, measurementsDir string, results *WorkloadResults) error {
+		// the default client side rate limit would throttle the updates far below the target QPS
+		restConfig := rest.CopyConfig(clusterProxy.GetRESTConfig())
+		restConfig.QPS = float32(2 * testConfig.UpdateQPS)
+		restConfig.Burst = 2 * testConfig.UpdateQPS
+		clientSet, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return errors.Wrap(err, "creating watch fan-out client")
+		}
+		results.WatchFanOut, err = RunWatchFanOut(ctx, clientSet, testConfig, time.Duration(testConfig.UpdateDurationMins)*time.Minute)
+		if results.WatchFanOut != nil {
+			if writeErr := writeJSON(filepath.Join(measurementsDir, "watch-delay.json"), results.WatchFanOut); writeErr != nil && err == nil {
+				err = writeErr
+			}
+		}
+		return err
+	})
+}
+
+// RunWatchFanOut waits for the objects of the watch-fanout workload to exist, starts WatchersPerNamespace watchers in
+// each namespace, each with a watch of its own, and updates the objects round robin at UpdateQPS for updateFor.
+// Results are returned as far as they got, also when an error is.
+func RunWatchFanOut(ctx context.Context, clientSet kubernetes.Interface, config WatchFanOutTestConfig, updateFor time.Duration) (*WatchFanOutResults, error) {
+	w := &watchFanOut{
+		clientSet: clientSet,
+		config:    config,
+		selector:  fmt.Sprintf("%s=%s", testIDLabel, watchFanOutTestID),
+	}
+	objects, err := w.waitForObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	watchCtx, stopWatchers := context.WithCancel(ctx)
+	defer stopWatchers()
+	watchers, err := w.startWatchers(watchCtx)
+	if err != nil {
+		return nil, err
+	}
+	utils.Logf("watch fan-out: %d watchers on %d objects, updating at %d/s for %s", watchers, len(objects), config.UpdateQPS, updateFor)
+
+	updates, missed, updateErr := w.update(ctx, objects, updateFor)
+	results := &WatchFanOutResults{
+		Updates:  updates,
+		Watchers: watchers,
+		Expected: updates * config.WatchersPerNamespace,
+		Missed:   missed,
+	}
+	// watchers may still be catching up with the last updates
+	_ = wait.PollImmediate(time.Second, watchFanOutDrainTimeout, func() (bool, error) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.delivered >= results.Expected || ctx.Err() != nil, nil
+	})
+	stopWatchers()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	results.Delivered = w.delivered
+	results.Delay = latencyPercentiles(w.delays)
+	utils.Logf("watch fan-out: %d of %d update events delivered, delay is p50=%s p90=%s p99=%s",
+		results.Delivered, results.Expected, results.Delay.Perc50, results.Delay.Perc90, results.Delay.Perc99)
+	if results.Missed > 0 {
+		utils.Logf("watch fan-out: %d updates found their object already deleted", results.Missed)
+	}
+	return results, updateErr
+}
+
+func (w *watchFanOut) namespaces() []string {
+	prefix := w.config.NamespacePrefix
+	if prefix == "" {
+		prefix = watchFanOutTestID
+	}
+	var namespaces []string
+	for i := 1; i <= w.config.Namespaces; i++ {
+		namespaces = append(namespaces, fmt.Sprintf("%s-%d", prefix, i))
+	}
+	return namespaces
+}
+
+// waitForObjects waits for clusterloader2 to create all the configmaps and secrets, and returns them.
+func (w *watchFanOut) waitForObjects(ctx context.Context) ([]watchFanOutObject, error) {
+	want := w.config.Namespaces * (w.config.ConfigMapsPerNamespace + w.config.SecretsPerNamespace)
+	var objects []watchFanOutObject
+	err := wait.PollImmediate(nativeChurnPollInterval, watchFanOutObjectsTimeout, func() (bool, error) {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		objects = nil
+		for _, ns := range w.namespaces() {
+			configMaps, err := w.clientSet.CoreV1().ConfigMaps(ns).List(ctx, metav1.ListOptions{LabelSelector: w.selector})
+			if err != nil {
+				utils.Logf("failed to list watch fan-out configmaps in %s, retrying: %v", ns, err)
+				return false, nil
+			}
+			for _, cm := range configMaps.Items {
+				objects = append(objects, watchFanOutObject{namespace: ns, name: cm.Name})
+			}
+			secrets, err := w.clientSet.CoreV1().Secrets(ns).List(ctx, metav1.ListOptions{LabelSelector: w.selector})
+			if err != nil {
+				utils.Logf("failed to list watch fan-out secrets in %s, retrying: %v", ns, err)
+				return false, nil
+			}
+			for _, s := range secrets.Items {
+				objects = append(objects, watchFanOutObject{namespace: ns, name: s.Name, secret: true})
+			}
+		}
+		return len(objects) >= want, nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "waiting for %d watch fan-out objects, found %d", want, len(objects))
+	}
+	return objects, nil
+}
+
+// startWatchers starts the watchers and returns how many there are. Each watcher has its own informers, so the API
+// server serves each of them a watch of its own.
+func (w *watchFanOut) startWatchers(ctx context.Context) (int, error) {
+	watchers := 0
+	for _, ns := range w.namespaces() {
+		for i := 0; i < w.config.WatchersPerNamespace; i++ {
+			factory := informers.NewSharedInformerFactoryWithOptions(w.clientSet, 0,
+				informers.WithNamespace(ns),
+				informers.WithTweakListOptions(func(o *metav1.ListOptions) { o.LabelSelector = w.selector }))
+			var synced []cache.InformerSynced
+			for _, informer := range []cache.SharedIndexInformer{
+				factory.Core().V1().ConfigMaps().Informer(),
+				factory.Core().V1().Secrets().Informer(),
+			} {
+				informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+					UpdateFunc: func(_, obj interface{}) { w.observe(obj, time.Now()) },
+				})
+				synced = append(synced, informer.HasSynced)
+			}
+			factory.Start(ctx.Done())
+			if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+				return watchers, errors.Errorf("timed out waiting for watcher %d in %s to sync", i, ns)
+			}
+			watchers++
+		}
+	}
+	return watchers, nil
+}
+
+// observe records the delay of an update event from when the update was made.
+func (w *watchFanOut) observe(obj interface{}, now time.Time) {
+	accessor, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+	updatedAt, err := time.Parse(time.RFC3339Nano, accessor.GetAnnotations()[watchFanOutUpdatedAtAnnotation])
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.delivered++
+	w.delays = append(w.delays, now.Sub(updatedAt))
+}
+
+// update patches the objects round robin at UpdateQPS for updateFor, and returns how many updates were made and how
+// many found their object already deleted by clusterloader2.
+func (w *watchFanOut) update(ctx context.Context, objects []watchFanOutObject, updateFor time.Duration) (int, int, error) {
+	limiter := flowcontrol.NewTokenBucketRateLimiter(float32(w.config.UpdateQPS), 1)
+	defer limiter.Stop()
+	var mu sync.Mutex
+	updates, missed := 0, 0
+	var ops []func(context.Context) error
+	for i := 0; i < int(updateFor.Seconds()*float64(w.config.UpdateQPS)); i++ {
+		object := objects[i%len(objects)]
+		ops = append(ops, func(ctx context.Context) error {
+			patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, watchFanOutUpdatedAtAnnotation, time.Now().Format(time.RFC3339Nano)))
+			var err error
+			if object.secret {
+				_, err = w.clientSet.CoreV1().Secrets(object.namespace).Patch(ctx, object.name, types.MergePatchType, patch, metav1.PatchOptions{})
+			} else {
+				_, err = w.clientSet.CoreV1().ConfigMaps(object.namespace).Patch(ctx, object.name, types.MergePatchType, patch, metav1.PatchOptions{})
+			}
+			if apierrors.IsNotFound(err) {
+				mu.Lock()
+				missed++
+				mu.Unlock()
+				return nil
+			}
+			if err != nil {
+				return errors.Wrapf(err, "updating %s/%s", object.namespace, object.name)
+			}
+			mu.Lock()
+			updates++
+			mu.Unlock()
+			return nil
+		})
+	}
+	err := runRateLimited(ctx, limiter, ops)
+	return updates, missed, err
+}
+
+// ExpectWatchFanOutSLOs fails the current spec if updates found their object already deleted, or the watch delivery
+// delay or the fraction of update events delivered breaches slo.
+func ExpectWatchFanOutSLOs(results *WatchFanOutResults, slo WatchFanOutSLO) {
+	Expect(results).NotTo(BeNil(), "watch fan-out results are required to check SLOs")
+	Expect(results.Missed).To(BeZero(), "updates found their object already deleted, clusterloader2 stopped holding the objects before the updates ended")
+	if results.Delivered < results.Expected {
+		utils.Logf("watchers observed %d of %d expected update events", results.Delivered, results.Expected)
+	}
+	if slo.MinDeliveredRatio > 0 {
+		Expect(results.Expected).To(BeNumerically(">", 0), "no update was made")
+		ratio := float64(results.Delivered) / float64(results.Expected)
+		utils.Logf("watch delivered ratio is %.4f, SLO minimum is %.4f", ratio, slo.MinDeliveredRatio)
+		Expect(ratio).To(BeNumerically(">=", slo.MinDeliveredRatio), "fraction of update events delivered is below SLO")
+	}
+	if slo.MaxWatchDelayP99 > 0 {
+		Expect(results.Delivered).To(BeNumerically(">", 0), "no update was observed by any watcher")
+		utils.Logf("watch delivery delay is p99=%s, SLO maximum is %s", results.Delay.Perc99, slo.MaxWatchDelayP99)
+		Expect(results.Delay.Perc99).To(BeNumerically("<=", slo.MaxWatchDelayP99), "p99 watch delivery delay is above SLO")
+	}
+}
+
+// expectSLOs checks the watch fan-out results against the SLO of the config.
+func (c WatchFanOutTestConfig) expectSLOs(results *WorkloadResults) {
+	ExpectWatchFanOutSLOs(results.WatchFanOut, c.SLO)
+}
@@ -0,0 +1,71 @@
+package specs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRunWatchFanOut(t *testing.T) {
+	g := NewWithT(t)
+	labels := map[string]string{testIDLabel: watchFanOutTestID}
+	var objects []runtime.Object
+	for _, ns := range []string{"watch-fanout-1", "watch-fanout-2"} {
+		objects = append(objects,
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "configmap-0", Labels: labels}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: "secret-0", Labels: labels}},
+		)
+	}
+	// objects of other tests are neither updated nor watched
+	objects = append(objects, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "watch-fanout-1", Name: "other"}})
+	clientSet := fake.NewSimpleClientset(objects...)
+	// clusterloader2 already deleted the secrets of the second namespace
+	clientSet.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() != "watch-fanout-2" {
+			return false, nil, nil
+		}
+		return true, nil, apierrors.NewNotFound(action.GetResource().GroupResource(), "secret-0")
+	})
+
+	results, err := RunWatchFanOut(context.Background(), clientSet, WatchFanOutTestConfig{
+		Namespaces:             2,
+		ConfigMapsPerNamespace: 1,
+		SecretsPerNamespace:    1,
+		WatchersPerNamespace:   3,
+		UpdateQPS:              100,
+	}, 200*time.Millisecond)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(results.Updates).To(Equal(15))
+	g.Expect(results.Missed).To(Equal(5))
+	g.Expect(results.Watchers).To(Equal(6))
+	// each update is in one namespace, so only the watchers of that namespace see it
+	g.Expect(results.Expected).To(Equal(45))
+	g.Expect(results.Delivered).To(Equal(results.Expected))
+
+	other, err := clientSet.CoreV1().ConfigMaps("watch-fanout-1").Get(context.Background(), "other", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(other.Annotations).To(BeEmpty())
+}
+
+func TestWatchFanOutObserve(t *testing.T) {
+	g := NewWithT(t)
+	w := &watchFanOut{}
+	updatedAt := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{watchFanOutUpdatedAtAnnotation: updatedAt.Format(time.RFC3339Nano)},
+	}}
+
+	w.observe(configMap, updatedAt.Add(150*time.Millisecond))
+	// updates made by others carry no timestamp and don't count
+	w.observe(&corev1.Secret{}, updatedAt)
+	g.Expect(w.delivered).To(Equal(1))
+	g.Expect(w.delays).To(Equal([]time.Duration{150 * time.Millisecond}))
+}
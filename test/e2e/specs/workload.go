@@ -0,0 +1,309 @@
+package specs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/azure/knarly/test/e2e/utils"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/informers"
+	"sigs.k8s.io/cluster-api/test/framework"
+	"sigs.k8s.io/yaml"
+)
+
+type (
+	// Workload is a clusterloader2 test config under test/workloads that specs can run.
+	Workload struct {
+		// Name identifies the workload in logs and artifacts
+		Name string
+		// ConfigPath is the path of the clusterloader2 test config, relative to test/workloads
+		ConfigPath string
+		// Timeout bounds how long clusterloader2 may run the workload for, zero means no timeout
+		Timeout time.Duration
+	}
+
+	// WorkloadParams is implemented by the typed test config of each registered workload.
+	WorkloadParams interface {
+		// WorkloadName returns the name of the registered workload the parameters are for
+		WorkloadName() string
+		// Validate checks the parameters without needing a cluster
+		Validate() error
+		// ClusterLoader2Params renders the parameters to the CL2_ variables read by the workload config
+		ClusterLoader2Params(ctx context.Context, clusterProxy framework.ClusterProxy) (map[string]interface{}, error)
+		// ClusterLoader2SLO returns the thresholds the clusterloader2 results must meet
+		ClusterLoader2SLO() ClusterLoader2SLO
+	}
+
+	// workloadSLOs is implemented by the params of workloads that measure more than every workload does, to check
+	// those measurements against thresholds of their own.
+	workloadSLOs interface {
+		expectSLOs(results *WorkloadResults)
+	}
+
+	// WorkloadResults are everything measured while a workload ran.
+	WorkloadResults struct {
+		// ClusterLoader2 are the results clusterloader2 reported
+		ClusterLoader2 *ClusterLoader2Results
+		// PodStartup are the pod startup latencies measured by the specs package itself
+		PodStartup *PodStartupResults
+		// APIServerLatency are the API server request latencies by verb and resource, empty if metrics couldn't be scraped
+		APIServerLatency []APIServerLatency
+		// Volumes are the PVC lifecycle latencies and failures by storage class, empty if the workload used no PVCs
+		Volumes *VolumeResults
+		// Endpoints are the EndpointSlice propagation latencies, empty if the workload created no services
+		Endpoints *EndpointResults
+		// WatchFanOut are the watch delivery delays, only set by the watch-fanout workload
+		WatchFanOut *WatchFanOutResults
+		// NodeResources are the resources used on each node, as sampled from the kubelet summary API
+		NodeResources *NodeResourceResults
+	}
+)
+
+// clusterLoader2GracePeriod is how long clusterloader2 is given to exit after being asked to stop, before it is killed.
+const clusterLoader2GracePeriod = time.Minute
+
+var (
+	workloads = map[string]Workload{}
+
+	workloadRunsMu sync.Mutex
+	// workloadRuns counts the runs of each workload against each cluster, see workloadRunID
+	workloadRuns = map[string]int{}
+)
+
+// RegisterWorkload makes a workload available to RunWorkload by name.
+func RegisterWorkload(workload Workload) {
+	if _, ok := workloads[workload.Name]; ok {
+		panic(fmt.Sprintf("workload %q is already registered", workload.Name))
+	}
+	workloads[workload.Name] = workload
+}
+
+// RunWorkload runs the workload that params belong to against the input cluster, and fails the spec if
+// clusterloader2 fails or the results breach the SLO of params.
+func RunWorkload(ctx context.Context, input ClusterTestInput, params WorkloadParams) *WorkloadResults {
+	return runWorkload(ctx, input, params, nil)
+}
+
+// runWorkload is RunWorkload, additionally running alongside, when set, for as long as clusterloader2 runs. Workloads
+// use it to drive load from the specs package that clusterloader2 can't, writing their results to measurementsDir
+// and to their field of results. An error from alongside fails the spec like a clusterloader2 failure does.
+func runWorkload(ctx context.Context, input ClusterTestInput, params WorkloadParams, alongside func(ctx context.Context, clusterProxy framework.ClusterProxy, measurementsDir string, results *WorkloadResults) error) *WorkloadResults {
+	Expect(params).NotTo(BeNil(), "Invalid argument. params can't be nil when calling RunWorkload")
+	workload, ok := workloads[params.WorkloadName()]
+	Expect(ok).To(BeTrue(), "Invalid argument. workload %q is not registered", params.WorkloadName())
+	specName := fmt.Sprintf("run-%s", workload.Name)
+	Expect(input.BootstrapClusterProxy).NotTo(BeNil(), "Invalid argument. input.BootstrapClusterProxy can't be nil when calling %s spec", specName)
+	Expect(input.Cluster).NotTo(BeNil(), "Invalid argument. input.Cluster can't be nil when calling %s spec", specName)
+	Expect(input.ArtifactFolder).NotTo(BeEmpty(), "Invalid argument. input.ArtifactFolder can't be empty when calling %s spec", specName)
+	Expect(input.ClusterLoader2).NotTo(BeNil(), "Invalid argument. input.ClusterLoader2 can't be nil when calling %s spec", specName)
+
+	Expect(params.Validate()).To(Succeed(), "Invalid parameters for workload %q", workload.Name)
+
+	clusterProxy := input.BootstrapClusterProxy.GetWorkloadCluster(ctx, input.Cluster.Namespace, input.Cluster.Name)
+	testConfigPath, err := input.ClusterLoader2.WorkloadConfig(workload.ConfigPath)
+	Expect(err).ToNot(HaveOccurred())
+	cl2Params, err := params.ClusterLoader2Params(ctx, clusterProxy)
+	Expect(err).ToNot(HaveOccurred(), "Failed to render parameters for workload %q", workload.Name)
+	runID := workloadRunID(input, workload.Name)
+	reportDir := clusterLoader2ReportDir(input, runID)
+	overridesPath := filepath.Join(filepath.Dir(reportDir), runID+"-overrides.yaml")
+	Expect(writeClusterLoader2Overrides(overridesPath, cl2Params)).To(Succeed())
+	summary := input.Summary.startWorkload(input.Cluster.Name, runID, workload.Name, cl2Params)
+	passed := false
+	defer func() { summary.finish(passed) }()
+
+	clusterloader2Command := exec.Command(input.ClusterLoader2.BinaryPath, fmt.Sprintf("--testconfig=%s", testConfigPath), fmt.Sprintf("--testoverrides=%s", overridesPath), "--provider=aks", fmt.Sprintf("--kubeconfig=%s", clusterProxy.GetKubeconfigPath()), fmt.Sprintf("--report-dir=%s", reportDir), "--v=2", "--enable-exec-service=false")
+	clusterloader2Command.Dir = input.ClusterLoader2.RootPath
+	logPath := filepath.Join(filepath.Dir(reportDir), runID+".log")
+	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	Expect(err).ToNot(HaveOccurred(), "Failed to open clusterloader2 log file %s", logPath)
+	defer logFile.Close()
+	// record the exact command first, so together with the overrides file the run can be replayed by hand
+	_, err = fmt.Fprintf(logFile, "# cd %s && %s\n", clusterloader2Command.Dir, clusterloader2Command.String())
+	Expect(err).ToNot(HaveOccurred(), "Failed to write clusterloader2 log file %s", logPath)
+	// stdout and stderr share one writer so their lines stay interleaved in the order they were written
+	output := utils.NewLineWriter(logFile)
+	clusterloader2Command.Stdout = output
+	clusterloader2Command.Stderr = output
+
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if workload.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, workload.Timeout)
+	} else {
+		runCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// the trackers and the event recorder share one informer per resource, so pods and events are listed and watched
+	// once, and the informers stop however the workload ends
+	informerCtx, stopInformers := context.WithCancel(ctx)
+	defer stopInformers()
+	factory := informers.NewSharedInformerFactory(clusterProxy.GetClientSet(), 0)
+	podStartup := NewPodStartupTracker(clusterProxy.GetClientSet(), factory)
+	Expect(podStartup.Start(informerCtx)).To(Succeed(), "Failed to start tracking pod startup for workload %q", workload.Name)
+	volumes := NewVolumeTracker(clusterProxy.GetClientSet(), factory)
+	Expect(volumes.Start(informerCtx)).To(Succeed(), "Failed to start tracking volumes for workload %q", workload.Name)
+	endpoints := NewEndpointSliceTracker(clusterProxy.GetClientSet(), factory)
+	Expect(endpoints.Start(informerCtx)).To(Succeed(), "Failed to start tracking EndpointSlices for workload %q", workload.Name)
+	stopRecordingEvents := recordWorkloadEvents(informerCtx, factory, input, runID)
+	stopSamplingNodes := recordWorkloadNodeResources(ctx, clusterProxy.GetClientSet(), input, runID)
+	// API server metrics are nice to have, not being able to scrape them should not fail the workload
+	apiServerBefore, err := ScrapeAPIServerLatency(ctx, clusterProxy.GetClientSet())
+	if err != nil {
+		utils.Logf("not measuring API server latency of workload %q: %v", workload.Name, err)
+	}
+
+	measurementsDir := workloadMeasurementsDir(input, runID)
+	results := &WorkloadResults{}
+	alongsideDone := make(chan error, 1)
+	if alongside != nil {
+		go func() {
+			alongsideDone <- alongside(runCtx, clusterProxy, measurementsDir, results)
+		}()
+	} else {
+		alongsideDone <- nil
+	}
+
+	utils.Logf("running workload %q with timeout %s, logging to %s: %s", workload.Name, workload.Timeout, logPath, clusterloader2Command.String())
+	runStart := time.Now()
+	runErr := runInProcessGroup(runCtx, clusterloader2Command, clusterLoader2GracePeriod)
+	Expect(output.Flush()).To(Succeed(), "Failed to write clusterloader2 log file %s", logPath)
+	// whatever runs alongside is done once clusterloader2 is, as the objects it works on are gone
+	cancel()
+	alongsideErr := <-alongsideDone
+
+	// whatever was measured before clusterloader2 failed or was stopped is still worth writing out and logging
+	results.PodStartup, results.Volumes, results.Endpoints = podStartup.Stop(), volumes.Stop(), endpoints.Stop()
+	stopRecordingEvents()
+	stopInformers()
+	results.NodeResources = stopSamplingNodes()
+	Expect(writeJSON(filepath.Join(measurementsDir, "pod-startup-latency.json"), results.PodStartup)).To(Succeed())
+	utils.Logf("%d of %d pods created by workload %q became ready, latencies by phase are %+v", results.PodStartup.Ready, results.PodStartup.Pods, workload.Name, results.PodStartup.Phases)
+	if len(results.Volumes.StorageClasses) > 0 {
+		Expect(writeJSON(filepath.Join(measurementsDir, "volume-latency.json"), results.Volumes)).To(Succeed())
+		logVolumeResults(workload.Name, results.Volumes)
+	}
+	if results.Endpoints.Endpoints > 0 {
+		Expect(writeJSON(filepath.Join(measurementsDir, "endpoint-latency.json"), results.Endpoints)).To(Succeed())
+		utils.Logf("%d pods of workload %q became ready endpoints, propagation latencies are %+v", results.Endpoints.Endpoints, workload.Name, results.Endpoints.Phases)
+	}
+	if apiServerBefore != nil {
+		apiServerAfter, err := ScrapeAPIServerLatency(ctx, clusterProxy.GetClientSet())
+		if err != nil {
+			utils.Logf("not measuring API server latency of workload %q: %v", workload.Name, err)
+		} else {
+			results.APIServerLatency = DiffAPIServerLatency(apiServerBefore, apiServerAfter)
+			Expect(writeAPIServerLatencyTable(filepath.Join(measurementsDir, "apiserver-latency.txt"), results.APIServerLatency)).To(Succeed())
+		}
+	}
+	results.ClusterLoader2, err = ParseClusterLoader2Results(reportDir, runStart)
+	Expect(err).ToNot(HaveOccurred())
+	summary.measured(results.summaryMeasurements())
+	Expect(runErr).ToNot(HaveOccurred(), "clusterloader2 failed running workload %q, see %s and the reports in %s", workload.Name, logPath, reportDir)
+	Expect(alongsideErr).ToNot(HaveOccurred(), "workload %q failed alongside clusterloader2", workload.Name)
+	ExpectClusterLoader2SLOs(results.ClusterLoader2, params.ClusterLoader2SLO())
+	if p, ok := params.(workloadSLOs); ok {
+		p.expectSLOs(results)
+	}
+	passed = true
+	return results
+}
+
+// summaryMeasurements returns the key measurements of a workload for the run summary.
+func (r *WorkloadResults) summaryMeasurements() map[string]float64 {
+	m := map[string]float64{}
+	if r.ClusterLoader2 != nil {
+		if d, ok := r.ClusterLoader2.Timers[overallDurationTimer]; ok {
+			m["overall_duration_seconds"] = d.Seconds()
+		}
+		if r.ClusterLoader2.SchedulingThroughput != nil {
+			m["scheduling_throughput_pods_per_second"] = r.ClusterLoader2.SchedulingThroughput.Average
+		}
+		if latency, ok := r.ClusterLoader2.PodStartupLatency[podStartupMetric]; ok {
+			m["pod_startup_latency_p50_seconds"] = latency.Perc50.Seconds()
+			m["pod_startup_latency_p99_seconds"] = latency.Perc99.Seconds()
+		}
+	}
+	if r.PodStartup != nil {
+		m["pods_ready"] = float64(r.PodStartup.Ready)
+		if latency, ok := r.PodStartup.Phases[PodStartupPhaseCreateToReady]; ok {
+			m["measured_pod_startup_latency_p99_seconds"] = latency.Perc99.Seconds()
+		}
+	}
+	if r.Volumes != nil && len(r.Volumes.StorageClasses) > 0 {
+		failures, running := 0, time.Duration(0)
+		for _, class := range r.Volumes.StorageClasses {
+			for _, count := range class.Failures {
+				failures += count
+			}
+			if latency := class.Phases[VolumePhaseTimeToPodRunning].Perc99; latency > running {
+				running = latency
+			}
+		}
+		m["volume_failures"] = float64(failures)
+		m["volume_time_to_pod_running_p99_seconds"] = running.Seconds()
+	}
+	if r.Endpoints != nil {
+		if latency, ok := r.Endpoints.Phases[EndpointPhaseReadyPropagation]; ok {
+			m["endpoint_ready_propagation_p99_seconds"] = latency.Perc99.Seconds()
+		}
+	}
+	if r.WatchFanOut != nil {
+		m["watch_delay_p99_seconds"] = r.WatchFanOut.Delay.Perc99.Seconds()
+		m["watch_events_undelivered"] = float64(r.WatchFanOut.Expected - r.WatchFanOut.Delivered)
+		m["watch_updates_missed"] = float64(r.WatchFanOut.Missed)
+	}
+	if r.NodeResources != nil {
+		for name, value := range r.NodeResources.summaryMeasurements() {
+			m[name] = value
+		}
+	}
+	return m
+}
+
+// writeClusterLoader2Overrides writes CL2_ variables to a clusterloader2 --testoverrides file.
+func writeClusterLoader2Overrides(path string, params map[string]interface{}) error {
+	b, err := yaml.Marshal(params)
+	if err != nil {
+		return errors.Wrapf(err, "rendering clusterloader2 overrides %s", path)
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return errors.Wrapf(err, "writing clusterloader2 overrides %s", path)
+	}
+	return nil
+}
+
+// workloadRunID returns the ID of a new run of workload against the input cluster, e.g. "incremental-scale-2" for the
+// second run. It names the artifacts of the run, so runs of the same workload against the same cluster don't
+// overwrite each other's.
+func workloadRunID(input ClusterTestInput, workload string) string {
+	workloadRunsMu.Lock()
+	defer workloadRunsMu.Unlock()
+	key := filepath.Join(input.ArtifactFolder, "clusters", input.Cluster.Name, workload)
+	workloadRuns[key]++
+	return fmt.Sprintf("%s-%d", workload, workloadRuns[key])
+}
+
+// clusterLoader2ReportDir creates and returns the directory clusterloader2 writes the summaries of a workload run into.
+// The directory must not exist yet, so the summaries parsed after the run are its own.
+func clusterLoader2ReportDir(input ClusterTestInput, runID string) string {
+	reportDir := filepath.Join(input.ArtifactFolder, "clusters", input.Cluster.Name, "clusterloader2", runID)
+	Expect(os.MkdirAll(filepath.Dir(reportDir), 0755)).To(Succeed(), "Failed to create clusterloader2 report directory %s", filepath.Dir(reportDir))
+	Expect(os.Mkdir(reportDir, 0755)).To(Succeed(), "Failed to create clusterloader2 report directory %s, which must not exist yet", reportDir)
+	return reportDir
+}
+
+// workloadMeasurementsDir creates and returns the directory the specs package writes its own measurements of a workload run into.
+func workloadMeasurementsDir(input ClusterTestInput, runID string) string {
+	measurementsDir := filepath.Join(input.ArtifactFolder, "clusters", input.Cluster.Name, "measurements", runID)
+	Expect(os.MkdirAll(measurementsDir, 0755)).To(Succeed(), "Failed to create measurements directory %s", measurementsDir)
+	return measurementsDir
+}
@@ -0,0 +1,23 @@
+package specs
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+func TestWorkloadRunID(t *testing.T) {
+	g := NewWithT(t)
+	artifactFolder := t.TempDir()
+	input := func(cluster string) ClusterTestInput {
+		return ClusterTestInput{ArtifactFolder: artifactFolder, Cluster: &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: cluster}}}
+	}
+
+	// the azurefile-csi and azuredisk-csi runs of the same workload against the same cluster
+	g.Expect(workloadRunID(input("aks"), IncrementalScaleWorkload)).To(Equal("incremental-scale-1"))
+	g.Expect(workloadRunID(input("aks"), IncrementalScaleWorkload)).To(Equal("incremental-scale-2"))
+	g.Expect(workloadRunID(input("aks"), DeploymentChurnWorkload)).To(Equal("deployment-churn-1"))
+	g.Expect(workloadRunID(input("other"), IncrementalScaleWorkload)).To(Equal("incremental-scale-1"))
+}
@@ -13,4 +13,13 @@ const (
 	AKSKubernetesVersion           = "AKS_KUBERNETES_VERSION"
 	AzureLocation                  = "AZURE_LOCATION"
 	ManagedClustersResourceType    = "managedClusters"
+	KnarlyRootPath                 = "KNARLY_ROOT"
+	ClusterLoader2Path             = "CLUSTERLOADER2_PATH"
+	ResultsDir                     = "KNARLY_RESULTS_DIR"
+	Baseline                       = "KNARLY_BASELINE"
+	RegressionRules                = "KNARLY_REGRESSION_RULES"
+	PushgatewayURL                 = "KNARLY_PUSHGATEWAY_URL"
+	PushgatewayJob                 = "KNARLY_PUSHGATEWAY_JOB"
+	EventNamespaces                = "KNARLY_EVENT_NAMESPACES"
+	EventReasons                   = "KNARLY_EVENT_REASONS"
 )
@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/profiles/2020-09-01/resources/mgmt/resources"
@@ -50,6 +51,54 @@ func log(level string, format string, args ...interface{}) {
 	fmt.Fprintf(GinkgoWriter, nowStamp()+": "+level+": "+format+"\n", args...)
 }
 
+// LineWriter logs each complete line written to it with Logf, and also writes it to out prefixed with a timestamp.
+// It is safe for concurrent use, so it can be shared by the stdout and stderr of a command.
+type LineWriter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	partial []byte
+}
+
+// NewLineWriter returns a LineWriter that copies lines to out.
+func NewLineWriter(out io.Writer) *LineWriter {
+	return &LineWriter{out: out}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimSuffix(string(w.partial[:i]), "\r")
+		w.partial = w.partial[i+1:]
+		if err := w.writeLine(line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Flush writes out any trailing line that was not terminated by a newline.
+func (w *LineWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) == 0 {
+		return nil
+	}
+	line := string(w.partial)
+	w.partial = nil
+	return w.writeLine(line)
+}
+
+func (w *LineWriter) writeLine(line string) error {
+	Logf("%s", line)
+	_, err := fmt.Fprintf(w.out, "%s: %s\n", nowStamp(), line)
+	return err
+}
+
 // ExecOnHost runs the specified command directly on a node's host, using an SSH connection
 // proxied through a control plane host.
 func ExecOnHost(controlPlaneEndpoint, hostname, port string, f io.StringWriter, command string,
@@ -183,13 +232,17 @@ type CleanupInput struct {
 	E2eConfig         *clusterctl.E2EConfig
 }
 
-func DumpSpecResourcesAndCleanup(ctx context.Context, input CleanupInput) {
+// DumpSpecResourcesAndCleanup collects the logs and resources of the spec when requested, deletes its clusters and
+// namespace unless cleanup is skipped, and returns how long collecting the logs and resources took.
+func DumpSpecResourcesAndCleanup(ctx context.Context, input CleanupInput) time.Duration {
 	defer func() {
 		input.CancelWatches()
 		redactLogs(input.E2eConfig)
 	}()
 
+	var logCollection time.Duration
 	if input.GetLogs {
+		start := time.Now()
 		if input.Cluster == nil {
 			By("Unable to dump workload cluster logs as the cluster is nil")
 		} else {
@@ -204,10 +257,11 @@ func DumpSpecResourcesAndCleanup(ctx context.Context, input CleanupInput) {
 			Namespace: input.Namespace.Name,
 			LogPath:   filepath.Join(input.ArtifactFolder, "clusters", input.ClusterProxy.GetName(), "resources"),
 		})
+		logCollection = time.Since(start)
 	}
 
 	if input.SkipCleanup {
-		return
+		return logCollection
 	}
 
 	Byf("Deleting all clusters in the %s namespace", input.Namespace.Name)
@@ -232,6 +286,7 @@ func DumpSpecResourcesAndCleanup(ctx context.Context, input CleanupInput) {
 
 	Byf("Checking if any resources are left over in Azure for spec %q", input.SpecName)
 	ExpectResourceGroupToBe404(ctx)
+	return logCollection
 }
 
 // ExpectResourceGroupToBe404 performs a GET request to Azure to determine if the cluster resource group still exists.